@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"os"
 	"time"
@@ -33,6 +34,13 @@ func main() {
 					},
 				},
 			},
+			{
+				Name:  "migrate",
+				Usage: "rewrite the config and all values files in the current format",
+				Action: func(c *cli.Context) (err error) {
+					return internal.Migrate(c.String("config"))
+				},
+			},
 			{
 				Name:    "seal",
 				Aliases: []string{"s"},
@@ -43,7 +51,9 @@ func main() {
 						return err
 					}
 
-					return sealit.Seal(c.Bool("force"))
+					sealit.OnlyFilesChangedSince(c.String("changed-since"))
+
+					return sealit.Seal(c.Bool("force"), c.Bool("remove-source"), c.Bool("gitignore-source"))
 				},
 				Flags: []cli.Flag{
 					&cli.BoolFlag{
@@ -51,11 +61,59 @@ func main() {
 						Value: false,
 						Usage: "seal with old certificate",
 					},
+					&cli.BoolFlag{
+						Name:  "remove-source",
+						Value: false,
+						Usage: "remove files referenced via @file: after sealing them",
+					},
+					&cli.BoolFlag{
+						Name:  "gitignore-source",
+						Value: false,
+						Usage: "add files referenced via @file: to the .gitignore after sealing them",
+					},
 					&cli.BoolFlag{
 						Name:  "fetch-cert",
 						Value: false,
 						Usage: "fetch latest cert from source",
 					},
+					&cli.StringFlag{
+						Name:  "changed-since",
+						Usage: "process only files added or modified since the git revision",
+					},
+				},
+			},
+			{
+				Name:  "seal-value",
+				Usage: "seal a single value read from stdin or a hidden prompt",
+				Action: func(c *cli.Context) (err error) {
+					return internal.SealValue(c.String("config"), c.String("kubeconfig"), c.String("rule"), c.String("cert"), c.String("name"), c.String("namespace"), c.String("scope"), c.Bool("prefix"))
+				},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: "name of the secret (default: name of the sealing rule)",
+					},
+					&cli.StringFlag{
+						Name:  "namespace",
+						Usage: "namespace of the secret (default: namespace of the sealing rule)",
+					},
+					&cli.StringFlag{
+						Name:  "scope",
+						Usage: "scope of the secret, either strict, namespace-wide or cluster-wide (default: derived from name and namespace)",
+					},
+					&cli.StringFlag{
+						Name:  "cert",
+						Usage: "path to the cert, instead of the cert source of the sealing rule",
+					},
+					&cli.StringFlag{
+						Name:  "rule",
+						Usage: "file name, which selects the sealing rule by its file regex (default: first sealing rule)",
+					},
+					&cli.BoolFlag{
+						Name:  "prefix",
+						Value: false,
+						Usage: "prefix the sealed value with the encryption prefix",
+					},
 				},
 			},
 			{
@@ -68,7 +126,46 @@ func main() {
 						return err
 					}
 
-					return sealit.Reseal()
+					return sealit.Reseal(c.Bool("outdated-only"), c.String("from-prefix"), c.String("from-metadata-key"))
+				},
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "outdated-only",
+						Value: false,
+						Usage: "reseal only values which were not sealed with the newest public cert",
+					},
+					&cli.StringFlag{
+						Name:  "from-prefix",
+						Usage: "prefix of the sealed values, in case it differs from the configured one",
+					},
+					&cli.StringFlag{
+						Name:  "from-metadata-key",
+						Usage: "key of the metadata block, in case it differs from the configured one",
+					},
+				},
+			},
+			{
+				Name:  "unseal",
+				Usage: "decrypt all secrets with the private keys of the controller and restore referenced files",
+				Action: func(c *cli.Context) (err error) {
+					sealit, err := internal.New(c.String("config"), c.String("kubeconfig"), false)
+					if err != nil {
+						return err
+					}
+
+					return sealit.Unseal()
+				},
+			},
+			{
+				Name:  "rescope",
+				Usage: "re-encrypt all secrets whose name or namespace differs from the sealing rules",
+				Action: func(c *cli.Context) (err error) {
+					sealit, err := internal.New(c.String("config"), c.String("kubeconfig"), true)
+					if err != nil {
+						return err
+					}
+
+					return sealit.Rescope()
 				},
 			},
 			{
@@ -80,7 +177,9 @@ func main() {
 					if err != nil {
 						return err
 					}
-					return sealit.Verify()
+
+					sealit.OnlyFilesChangedSince(c.String("changed-since"))
+					return sealit.Verify(c.Bool("staged"), c.Bool("strict"))
 				},
 				Flags: []cli.Flag{
 					&cli.BoolFlag{
@@ -88,6 +187,84 @@ func main() {
 						Value: false,
 						Usage: "fetch latest cert from source",
 					},
+					&cli.StringFlag{
+						Name:  "changed-since",
+						Usage: "process only files added or modified since the git revision",
+					},
+					&cli.BoolFlag{
+						Name:  "staged",
+						Value: false,
+						Usage: "verify the content staged in the git index instead of the working tree",
+					},
+					&cli.BoolFlag{
+						Name:  "strict",
+						Value: false,
+						Usage: "verify the embedded cert against the cert source",
+					},
+				},
+			},
+			{
+				Name:  "hook",
+				Usage: "manage the git pre-commit hook",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "install",
+						Usage: "install a pre-commit hook which verifies the staged files",
+						Action: func(c *cli.Context) error {
+							return internal.InstallHook(c.String("config"))
+						},
+					},
+					{
+						Name:  "uninstall",
+						Usage: "remove the pre-commit hook installed by sealit",
+						Action: func(c *cli.Context) error {
+							return internal.UninstallHook()
+						},
+					},
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "show which secrets changed between two git revisions",
+				ArgsUsage: "<revision> <revision> [file]",
+				Action: func(c *cli.Context) (err error) {
+					if c.NArg() < 2 {
+						return errors.New("two git revisions are required")
+					}
+
+					sealit, err := internal.New(c.String("config"), c.String("kubeconfig"), false)
+					if err != nil {
+						return err
+					}
+
+					return sealit.Diff(c.Args().Get(0), c.Args().Get(1), c.Args().Get(2))
+				},
+			},
+			{
+				Name:  "status",
+				Usage: "show an overview of all sealed files",
+				Action: func(c *cli.Context) (err error) {
+					sealit, err := internal.New(c.String("config"), c.String("kubeconfig"), false)
+					if err != nil {
+						return err
+					}
+
+					return sealit.Status(c.String("output"))
+				},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Value:   "table",
+						Usage:   "output format, either table or json",
+					},
+				},
+			},
+			{
+				Name:  "helm-post-render",
+				Usage: "turn rendered Secrets and SealedSecrets with sealed values into SealedSecrets, reads manifests from stdin",
+				Action: func(c *cli.Context) error {
+					return internal.HelmPostRender(c.String("config"), os.Stdin, os.Stdout)
 				},
 			},
 			{
@@ -95,7 +272,7 @@ func main() {
 				Aliases: []string{"t"},
 				Usage:   "create a sealed secrets template",
 				Action: func(c *cli.Context) error {
-					return internal.Template(c.String("file"))
+					return internal.Template(c.String("config"), c.String("file"), c.String("values"), c.String("chart"), c.Bool("helper"))
 				},
 				Flags: []cli.Flag{
 					&cli.StringFlag{
@@ -103,6 +280,19 @@ func main() {
 						Value: "",
 						Usage: "file path for template",
 					},
+					&cli.StringFlag{
+						Name:  "values",
+						Usage: "sealed values file, for which the encrypted data is generated",
+					},
+					&cli.StringFlag{
+						Name:  "chart",
+						Usage: "path of the chart, whose labels helper is used (default: parent of the template folder or current dir)",
+					},
+					&cli.BoolFlag{
+						Name:  "helper",
+						Value: false,
+						Usage: "create the named templates of `_sealit.tpl` instead of a SealedSecret",
+					},
 				},
 			},
 		},
@@ -116,6 +306,27 @@ func main() {
 				Name:  "kubeconfig",
 				Usage: "path to the kubeconfig file",
 			},
+			&cli.StringFlag{
+				Name:    "server",
+				Usage:   "address of the Kubernetes API server, overrides the kubeconfig",
+				EnvVars: []string{"SEALIT_SERVER"},
+			},
+			&cli.StringFlag{
+				Name:    "token",
+				Usage:   "bearer token for the Kubernetes API server, overrides the kubeconfig",
+				EnvVars: []string{"SEALIT_TOKEN"},
+			},
+			&cli.StringFlag{
+				Name:    "certificate-authority",
+				Usage:   "path to the CA cert of the Kubernetes API server, overrides the kubeconfig",
+				EnvVars: []string{"SEALIT_CERTIFICATE_AUTHORITY"},
+			},
+			&cli.BoolFlag{
+				Name:    "non-interactive",
+				Value:   false,
+				Usage:   "fail instead of prompting for Kubernetes credentials",
+				EnvVars: []string{"SEALIT_NON_INTERACTIVE"},
+			},
 			&cli.BoolFlag{
 				Name:  "debug",
 				Value: false,
@@ -134,6 +345,7 @@ func main() {
 			}
 
 			log.SetOutput(filter)
+			internal.SetKubernetesCredentials(c.String("server"), c.String("token"), c.String("certificate-authority"), c.Bool("non-interactive"))
 
 			return err
 		},
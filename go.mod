@@ -6,6 +6,7 @@ require (
 	github.com/bitnami-labs/sealed-secrets v0.12.2
 	github.com/hashicorp/logutils v1.0.0
 	github.com/urfave/cli/v2 v2.2.0
+	golang.org/x/crypto v0.0.0-20200220183623-bac4c82f6975
 	golang.org/x/sys v0.0.0-20200509044756-6aff5f38e54f // indirect
 	gopkg.in/yaml.v3 v3.0.0-20200506231410-2ff61e1afc86
 	k8s.io/api v0.16.8
@@ -7,6 +7,7 @@ import (
 )
 
 type Config struct {
+	Version         int              `yaml:"version"`
 	SealingRuleSets []SealingRuleSet `yaml:"sealingRules"`
 }
 
@@ -15,6 +16,7 @@ func ExampleConfig() Config {
 	d, _ := time.ParseDuration("720h")
 
 	return Config{
+		Version: currentConfigVersion,
 		SealingRuleSets: []SealingRuleSet{
 			{
 				FileRegex:    "\\.dev\\.yaml$",
@@ -24,12 +26,12 @@ func ExampleConfig() Config {
 				Cert: &Cert{
 					MaxAge: d,
 					Sources: &Sources{
-						Kubernetes: KubernetesCertSource{
+						Kubernetes: &KubernetesCertSource{
 							Context:   "KubeContextName",
 							Name:      "sealed-secrets",
 							Namespace: "kube-system",
 						},
-						Url:  "https://example.org",
+						Url:  UrlCertSource{Url: "https://example.org"},
 						Path: "cert.pem",
 					},
 				},
@@ -38,6 +40,21 @@ func ExampleConfig() Config {
 	}
 }
 
+// LoadConfig parses the config file and upgrades configs of older versions
 func LoadConfig(file []byte) (config Config, err error) {
-	return config, yaml.Unmarshal(file, &config)
+	var n yaml.Node
+
+	if err := yaml.Unmarshal(file, &n); err != nil {
+		return config, err
+	}
+
+	if err := upgradeConfigNode(&n); err != nil {
+		return config, err
+	}
+
+	if len(n.Content) == 0 {
+		return config, nil
+	}
+
+	return config, n.Decode(&config)
 }
@@ -0,0 +1,233 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	secretAdded     = "added"
+	secretRemoved   = "removed"
+	secretChanged   = "changed"
+	secretUnchanged = "unchanged"
+)
+
+type decryptor struct {
+	secretsRegexp *regexp.Regexp
+	metadata      *Metadata
+	prefix        string
+	privateKeys   map[string]*rsa.PrivateKey
+	label         []byte
+	secrets       map[string][]byte
+}
+
+// Diff compares the decrypted secrets of all matching files between two git revisions.
+// Files are listed from both revisions, so files added or deleted in between are compared as well.
+// Only the kind of change is reported, the secrets itself are never printed.
+func (s *Sealit) Diff(fromRevision string, toRevision string, file string) (err error) {
+	var files []string
+
+	if file != "" {
+		files = []string{file}
+	} else if files, err = gitFilesAtRevisions(fromRevision, toRevision); err != nil {
+		return err
+	}
+
+	pKeysOfRuleSets := map[int]map[string]*rsa.PrivateKey{}
+	matched := false
+
+	for _, f := range files {
+		for i := range s.config.SealingRuleSets {
+			srs := &s.config.SealingRuleSets[i]
+			if !regexp.MustCompile(srs.FileRegex).MatchString(f) {
+				continue
+			}
+
+			matched = true
+
+			fromData, err := readFileAtRevision(fromRevision, f)
+			if err != nil {
+				return fmt.Errorf("in file %s at revision %s %s", f, fromRevision, err.Error())
+			}
+
+			toData, err := readFileAtRevision(toRevision, f)
+			if err != nil {
+				return fmt.Errorf("in file %s at revision %s %s", f, toRevision, err.Error())
+			}
+
+			if isManifest(fromData) || isManifest(toData) {
+				log.Printf("[DEBUG] Skip file %s as SealedSecret manifests can not be diffed", f)
+				continue
+			}
+
+			// The keys are fetched once per rule set, as every fetch queries the cluster
+			pKeys, ok := pKeysOfRuleSets[i]
+			if !ok {
+				if pKeys, err = diffPrivateKeys(srs); err != nil {
+					return err
+				}
+
+				pKeysOfRuleSets[i] = pKeys
+			}
+
+			from, err := loadSecrets(srs, pKeys, f, fromData)
+			if err != nil {
+				return fmt.Errorf("in file %s at revision %s %s", f, fromRevision, err.Error())
+			}
+
+			to, err := loadSecrets(srs, pKeys, f, toData)
+			if err != nil {
+				return fmt.Errorf("in file %s at revision %s %s", f, toRevision, err.Error())
+			}
+
+			printSecretsDiff(os.Stdout, f, diffSecrets(from, to))
+		}
+	}
+
+	if file != "" && !matched {
+		return fmt.Errorf("file %s matches no sealing rule", file)
+	}
+
+	return nil
+}
+
+// diffPrivateKeys returns the private keys of the controllers of the rule set and of all its targets
+func diffPrivateKeys(srs *SealingRuleSet) (map[string]*rsa.PrivateKey, error) {
+	certs := []*Cert{srs.Cert}
+	for _, t := range srs.Targets {
+		certs = append(certs, t.Cert)
+	}
+
+	var pKeys map[string]*rsa.PrivateKey
+
+	for _, c := range certs {
+		if c == nil || c.Sources == nil || c.Sources.Kubernetes == nil {
+			continue
+		}
+
+		keys, _, err := c.Sources.Kubernetes.fetchKeys()
+		if err != nil {
+			return nil, err
+		}
+
+		if pKeys == nil {
+			pKeys = map[string]*rsa.PrivateKey{}
+		}
+
+		for fingerprint, key := range keys {
+			pKeys[fingerprint] = key
+		}
+	}
+
+	if pKeys == nil {
+		return nil, errors.New("diffing works only with Kubernetes cert source")
+	}
+
+	return pKeys, nil
+}
+
+// readFileAtRevision returns the content of the file at the revision or nil, if the file does not exist
+func readFileAtRevision(revision string, path string) ([]byte, error) {
+	if !gitFileExistsAtRevision(revision, path) {
+		log.Printf("[DEBUG] File %s does not exist at revision %s", path, revision)
+		return nil, nil
+	}
+
+	return gitReadFileAtRevision(revision, path)
+}
+
+// loadSecrets decrypts the secrets of the values file, a missing file has no secrets
+func loadSecrets(srs *SealingRuleSet, pKeys map[string]*rsa.PrivateKey, path string, data []byte) (map[string][]byte, error) {
+	if data == nil {
+		return map[string][]byte{}, nil
+	}
+
+	log.Printf("[DEBUG] Load values file %s", path)
+	vf, err := loadValuesFile(srs, path, data, srs.GetMetadataKey())
+	if err != nil {
+		return nil, err
+	}
+
+	d := &decryptor{
+		secretsRegexp: srs.GetSecretsRegex(),
+		metadata:      vf.getMetadata(),
+		prefix:        srs.GetEncryptionPrefix(),
+		privateKeys:   pKeys,
+		label:         vf.getMetadata().getLabel(),
+		secrets:       map[string][]byte{},
+	}
+
+	if err := vf.ApplyFuncToValues(d.Decrypt); err != nil {
+		return nil, err
+	}
+
+	return d.secrets, nil
+}
+
+// Decrypt collects the plaintext of every secret by its path
+func (d *decryptor) Decrypt(path string, key *yaml.Node, value *yaml.Node) error {
+	if !isSecretOfFile(d.secretsRegexp, d.metadata, path, key, value) {
+		return nil
+	}
+
+	if !strings.HasPrefix(value.Value, d.prefix) {
+		log.Printf("[WARNING] Value of `%s` is not encrypted", key.Value)
+		d.secrets[path] = []byte(value.Value)
+		return nil
+	}
+
+	plaintext, err := decryptValue(d.privateKeys, d.label, strings.TrimPrefix(value.Value, d.prefix))
+	if err != nil {
+		return err
+	}
+
+	d.secrets[path] = plaintext
+
+	return nil
+}
+
+// diffSecrets returns the kind of change for every path of both versions
+func diffSecrets(from map[string][]byte, to map[string][]byte) map[string]string {
+	changes := map[string]string{}
+
+	for path, fromSecret := range from {
+		if toSecret, ok := to[path]; !ok {
+			changes[path] = secretRemoved
+		} else if bytes.Equal(fromSecret, toSecret) {
+			changes[path] = secretUnchanged
+		} else {
+			changes[path] = secretChanged
+		}
+	}
+
+	for path := range to {
+		if _, ok := from[path]; !ok {
+			changes[path] = secretAdded
+		}
+	}
+
+	return changes
+}
+
+func printSecretsDiff(w io.Writer, file string, changes map[string]string) {
+	paths := make([]string, 0, len(changes))
+	for path := range changes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	fmt.Fprintln(w, file)
+	for _, path := range paths {
+		fmt.Fprintf(w, "  %s: %s\n", path, changes[path])
+	}
+}
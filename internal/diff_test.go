@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"bytes"
+	cryptoRand "crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDiffSecrets(t *testing.T) {
+	from := map[string][]byte{
+		"env.password":         []byte("secret"),
+		"env.pin":              []byte("1234"),
+		"env.removed_password": []byte("old"),
+	}
+	to := map[string][]byte{
+		"env.password":       []byte("secret"),
+		"env.pin":            []byte("4321"),
+		"env.added_password": []byte("new"),
+	}
+
+	changes := diffSecrets(from, to)
+	expected := map[string]string{
+		"env.password":         secretUnchanged,
+		"env.pin":              secretChanged,
+		"env.removed_password": secretRemoved,
+		"env.added_password":   secretAdded,
+	}
+
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Diff was incorrect, got: %v, want: %v.", changes, expected)
+	}
+}
+
+func TestDecryptSecrets(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	fp, _ := crypto.PublicKeyFingerprint(&key.PublicKey)
+	m := &Metadata{Name: "secret", Namespace: "default"}
+
+	s := Sealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		label:         m.getLabel(),
+		metadata:      m,
+	}
+
+	v := &yaml.Node{Value: "secret!"}
+	s.Seal("env.password", &yaml.Node{Value: "password"}, v)
+
+	d := &decryptor{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		metadata:      m,
+		prefix:        encodeIdentifier,
+		privateKeys:   map[string]*rsa.PrivateKey{fp: key},
+		label:         m.getLabel(),
+		secrets:       map[string][]byte{},
+	}
+
+	if err := d.Decrypt("env.password", &yaml.Node{Value: "password"}, v); err != nil {
+		t.Fatalf("Decrypt was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if string(d.secrets["env.password"]) != "secret!" {
+		t.Errorf("Decrypted secret was incorrect, got: %s, want: %s.", d.secrets["env.password"], "secret!")
+	}
+}
+
+func TestDecryptFileReference(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	fp, _ := crypto.PublicKeyFingerprint(&key.PublicKey)
+	m := &Metadata{Name: "secret", Namespace: "default", Secrets: map[string]*SecretMetadata{"tls.key": {File: "tls.key"}}}
+
+	ciphertext, _ := crypto.HybridEncrypt(cryptoRand.Reader, &key.PublicKey, []byte("private key"), m.getLabel())
+	v := &yaml.Node{Value: encodeIdentifier + base64.StdEncoding.EncodeToString(ciphertext)}
+
+	d := &decryptor{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		metadata:      m,
+		prefix:        encodeIdentifier,
+		privateKeys:   map[string]*rsa.PrivateKey{fp: key},
+		label:         m.getLabel(),
+		secrets:       map[string][]byte{},
+	}
+
+	if err := d.Decrypt("tls.key", &yaml.Node{Value: "key"}, v); err != nil {
+		t.Fatalf("Decrypt was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if string(d.secrets["tls.key"]) != "private key" {
+		t.Errorf("Decrypted secret was incorrect, got: %s, want: %s.", d.secrets["tls.key"], "private key")
+	}
+}
+
+func TestPrintSecretsDiff(t *testing.T) {
+	var b bytes.Buffer
+
+	printSecretsDiff(&b, "values.dev.yaml", map[string]string{
+		"env.pin":      secretChanged,
+		"env.password": secretUnchanged,
+	})
+
+	expected := "values.dev.yaml\n  env.password: unchanged\n  env.pin: changed\n"
+
+	if b.String() != expected {
+		t.Errorf("Diff output was incorrect, got: \n%s\n, want: \n%s\n.", b.String(), expected)
+	}
+}
+
+func TestDiffUnmatchedFile(t *testing.T) {
+	s := &Sealit{config: &Config{SealingRuleSets: []SealingRuleSet{{FileRegex: `values\.dev\.yaml$`}}}}
+
+	if err := s.Diff("HEAD~1", "HEAD", "values.prod.yaml"); err == nil || err.Error() != "file values.prod.yaml matches no sealing rule" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+}
+
+func TestDiffSkipsManifests(t *testing.T) {
+	defer testGitRepo(t)()
+
+	commit := func() {
+		git("-c", "user.name=sealit", "-c", "user.email=sealit@example.org", "commit", "-m", "secrets")
+	}
+
+	ioutil.WriteFile("secrets.dev.yaml", secretManifests, 0644)
+	git("add", ".")
+	commit()
+	ioutil.WriteFile("secrets.dev.yaml", bytes.Replace(secretManifests, []byte("password: secret"), []byte("password: changed"), 1), 0644)
+	git("add", ".")
+	commit()
+
+	s := &Sealit{config: &Config{SealingRuleSets: []SealingRuleSet{{FileRegex: `\.dev\.yaml$`, Cert: &Cert{}}}}}
+
+	if err := s.Diff("HEAD~1", "HEAD", ""); err != nil {
+		t.Fatalf("Diff was unsuccessful, got an error %s.", err.Error())
+	}
+}
@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Timeout of the command printing the cert, unless `timeout` is set
+const defaultExecTimeout = 30 * time.Second
+
+// Time to wait for the output to be closed after the command was killed or exited
+const execWaitDelay = time.Second
+
+// ExecCertSource runs a command, which prints the PEM encoded cert to stdout
+type ExecCertSource struct {
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+	Timeout time.Duration     `yaml:"timeout,omitempty"`
+}
+
+func (e ExecCertSource) fetch() (io.ReadCloser, error) {
+	log.Printf("[DEBUG] Fetch cert from the output of %s", e.Command)
+
+	timeout := e.Timeout
+	if timeout == 0 {
+		timeout = defaultExecTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Command, e.Args...)
+	cmd.Env = os.Environ()
+	for name, value := range e.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+
+	if err := runWithPipes(cmd, &stdout, &stderr); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("command %s timed out after %s", e.Command, timeout)
+		}
+
+		return nil, fmt.Errorf("command %s failed: %v %s", e.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if block, _ := pem.Decode(stdout.Bytes()); block == nil {
+		return nil, fmt.Errorf("command %s printed no PEM encoded cert", e.Command)
+	}
+
+	return ioutil.NopCloser(&stdout), nil
+}
+
+// runWithPipes runs the command with pipes for stdout and stderr. Children of a killed command may keep
+// the pipes open, so they are closed, if the output is not complete shortly after the command exited.
+func runWithPipes(cmd *exec.Cmd, stdout io.Writer, stderr io.Writer) (err error) {
+	copied := make(chan struct{}, 2)
+
+	stdoutReader, stdoutWriter, err := copyFromPipe(stdout, copied)
+	if err != nil {
+		return err
+	}
+	defer stdoutReader.Close()
+
+	stderrReader, stderrWriter, err := copyFromPipe(stderr, copied)
+	if err != nil {
+		stdoutWriter.Close()
+		return err
+	}
+	defer stderrReader.Close()
+
+	cmd.Stdout, cmd.Stderr = stdoutWriter, stderrWriter
+	err = cmd.Start()
+
+	// Only the command holds the writers now, so copying ends once it and its children exited
+	stdoutWriter.Close()
+	stderrWriter.Close()
+
+	if err == nil {
+		err = cmd.Wait()
+	}
+
+	timer := time.NewTimer(execWaitDelay)
+	defer timer.Stop()
+
+	for remaining := 2; remaining > 0; {
+		select {
+		case <-copied:
+			remaining--
+		case <-timer.C:
+			log.Print("[DEBUG] Close the output of the command, as its children still hold it open")
+			stdoutReader.Close()
+			stderrReader.Close()
+		}
+	}
+
+	return err
+}
+
+// copyFromPipe creates a pipe and copies everything written to it to the writer
+func copyFromPipe(w io.Writer, copied chan<- struct{}) (*os.File, *os.File, error) {
+	r, pw, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	go func() {
+		io.Copy(w, r)
+		copied <- struct{}{}
+	}()
+
+	return r, pw, nil
+}
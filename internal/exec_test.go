@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchFromExec(t *testing.T) {
+	source := ExecCertSource{
+		Command: "sh",
+		Args:    []string{"-c", "printf -- '-----BEGIN CERTIFICATE-----\\n%s\\n-----END CERTIFICATE-----\\n' \"$CERT\""},
+		Env:     map[string]string{"CERT": "YWJj"},
+	}
+
+	r, err := source.fetch()
+	if err != nil {
+		t.Fatalf("Fetching was unsuccessful, got an error %s.", err.Error())
+	}
+
+	cert, _ := ioutil.ReadAll(r)
+	if !strings.Contains(string(cert), "YWJj") {
+		t.Errorf("Cert was incorrect, got: %s.", cert)
+	}
+}
+
+func TestFetchFromFailingExec(t *testing.T) {
+	if _, err := (ExecCertSource{Command: "sh", Args: []string{"-c", "echo denied >&2; exit 3"}}).fetch(); err == nil || err.Error() != "command sh failed: exit status 3 denied" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+
+	if _, err := (ExecCertSource{Command: "echo", Args: []string{"no cert"}}).fetch(); err == nil || err.Error() != "command echo printed no PEM encoded cert" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+
+	if _, err := (ExecCertSource{Command: "sleep", Args: []string{"5"}, Timeout: 10 * time.Millisecond}).fetch(); err == nil || err.Error() != "command sleep timed out after 10ms" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+}
+
+func TestFetchFromTimedOutPipeline(t *testing.T) {
+	start := time.Now()
+
+	if _, err := (ExecCertSource{Command: "sh", Args: []string{"-c", "sleep 5 | cat"}, Timeout: 10 * time.Millisecond}).fetch(); err == nil || err.Error() != "command sh timed out after 10ms" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Duration was incorrect, got: %s.", elapsed)
+	}
+}
@@ -0,0 +1,427 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FlatFile is a values file of key value pairs like dotenv or Java properties files.
+// The metadata is stored as commented yaml block at the end of the file.
+type FlatFile struct {
+	lines       []*flatLine
+	format      string
+	newline     string
+	metadataKey string
+	Metadata    *Metadata
+}
+
+type flatLine struct {
+	raw      string
+	entry    bool
+	before   string
+	key      string
+	rawValue string
+	value    string
+	quote    string
+	after    string
+}
+
+func newFlatFile(d []byte, format string, metadataKey string) (*FlatFile, error) {
+	f := &FlatFile{
+		format:      format,
+		newline:     "\n",
+		metadataKey: metadataKey,
+		Metadata:    &Metadata{},
+	}
+
+	content := string(d)
+	if strings.Contains(content, "\r\n") {
+		f.newline = "\r\n"
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	var metadataLines []string
+
+	for i := 0; i < len(lines); i++ {
+		if lines[i] == fmt.Sprintf("# %s:", metadataKey) {
+			log.Printf("[DEBUG] Found metadata block in line %d", i+1)
+			metadataLines = append(metadataLines, fmt.Sprintf("%s:", metadataKey))
+
+			// The block ends at the first line, which is not indented like Export writes it or breaks the yaml,
+			// so comments following the block are kept as comments
+			for i+1 < len(lines) && isMetadataLine(metadataLines, lines[i+1]) {
+				i++
+				metadataLines = append(metadataLines, strings.TrimPrefix(lines[i], "# "))
+			}
+
+			continue
+		}
+
+		var line *flatLine
+		var err error
+
+		if format == propertiesFormat {
+			line, err = parsePropertiesLine(lines[i])
+		} else {
+			line, err = parseDotenvLine(lines[i])
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("in line %d %s", i+1, err.Error())
+		}
+
+		f.lines = append(f.lines, line)
+	}
+
+	if metadataLines != nil {
+		if err := f.loadMetadata(strings.Join(metadataLines, "\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// isMetadataLine checks if the commented line continues the metadata block
+func isMetadataLine(metadataLines []string, line string) bool {
+	if !strings.HasPrefix(line, "#     ") {
+		return false
+	}
+
+	var n yaml.Node
+	return yaml.Unmarshal([]byte(strings.Join(append(metadataLines, strings.TrimPrefix(line, "# ")), "\n")), &n) == nil
+}
+
+func (f *FlatFile) loadMetadata(d string) error {
+	var n yaml.Node
+
+	if err := yaml.Unmarshal([]byte(d), &n); err != nil {
+		return fmt.Errorf("metadata block is invalid: %s", err.Error())
+	}
+
+	if metadata := getValue(n.Content[0], f.metadataKey); metadata != nil && metadata.Kind == yaml.MappingNode {
+		if err := upgradeMetadataNode(metadata); err != nil {
+			return err
+		}
+
+		return metadata.Decode(f.Metadata)
+	}
+
+	return nil
+}
+
+func (f *FlatFile) getMetadata() *Metadata {
+	return f.Metadata
+}
+
+// applyFuncToTarget applies the manipulator to all values, as flat files have no target maps
+func (f *FlatFile) applyFuncToTarget(target string, manipulator func(string, *yaml.Node, *yaml.Node) error) error {
+	return f.ApplyFuncToValues(manipulator)
+}
+
+// applyFuncToTargetMaps applies the manipulator to all values, as flat files have no target maps
+func (f *FlatFile) applyFuncToTargetMaps(manipulator func(string, *yaml.Node, *yaml.Node) error) error {
+	return f.ApplyFuncToValues(manipulator)
+}
+
+func (f *FlatFile) ApplyFuncToValues(manipulator func(string, *yaml.Node, *yaml.Node) error) error {
+	log.Printf("[DEBUG] Apply manipulation function to %s entries", f.format)
+	for _, line := range f.lines {
+		if !line.entry {
+			continue
+		}
+
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: line.key}
+		value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: line.value}
+
+		if err := manipulator(line.key, key, value); err != nil {
+			return fmt.Errorf("at key %s %s", line.key, err.Error())
+		}
+
+		line.value = value.Value
+	}
+
+	return nil
+}
+
+// MoveMetadata changes the key of the metadata block, which is written on export
+func (f *FlatFile) MoveMetadata(metadataKey string) {
+	f.metadataKey = metadataKey
+}
+
+func (f *FlatFile) Export() ([]byte, error) {
+	keys := map[string]bool{}
+	var b strings.Builder
+
+	for _, line := range f.lines {
+		if line.entry {
+			keys[line.key] = true
+		}
+
+		b.WriteString(f.render(line))
+		b.WriteString(f.newline)
+	}
+
+	for path := range f.Metadata.Secrets {
+		if !keys[path] {
+			log.Printf("[DEBUG] Remove metadata of `%s` as the key does not exist anymore", path)
+			delete(f.Metadata.Secrets, path)
+		}
+	}
+
+	f.Metadata.Version = currentMetadataVersion
+
+	metadata, err := yaml.Marshal(map[string]*Metadata{f.metadataKey: f.Metadata})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(metadata), "\n"), "\n") {
+		b.WriteString(fmt.Sprintf("# %s", line))
+		b.WriteString(f.newline)
+	}
+
+	return []byte(b.String()), nil
+}
+
+func (f *FlatFile) render(line *flatLine) string {
+	if !line.entry {
+		return line.raw
+	}
+
+	value := line.rawValue
+
+	// Keep the original notation of unchanged values
+	if line.value != f.unescape(line.rawValue, line.quote) {
+		value = f.escape(line.value, line.quote)
+	}
+
+	return fmt.Sprintf("%s%s%s%s%s", line.before, line.quote, value, line.quote, line.after)
+}
+
+func (f *FlatFile) unescape(s string, quote string) string {
+	if f.format == propertiesFormat {
+		return unescapeProperty(s)
+	} else if quote == `"` {
+		return unescapeDotenv(s)
+	}
+
+	return s
+}
+
+func (f *FlatFile) escape(s string, quote string) string {
+	if f.format == propertiesFormat {
+		return escapeProperty(s)
+	} else if quote == `"` {
+		return escapeDotenv(s)
+	}
+
+	return s
+}
+
+// parseDotenvLine parses lines like `KEY=value`, `export KEY="value"` or `KEY='value' # comment`
+func parseDotenvLine(raw string) (*flatLine, error) {
+	trimmed := strings.TrimSpace(raw)
+	separator := strings.Index(raw, "=")
+
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || separator < 0 {
+		return &flatLine{raw: raw}, nil
+	}
+
+	key := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(raw[:separator]), "export "))
+	rest := raw[separator+1:]
+	valueStart := len(rest) - len(strings.TrimLeft(rest, " \t"))
+	line := &flatLine{
+		raw:    raw,
+		entry:  true,
+		before: raw[:separator+1] + rest[:valueStart],
+		key:    key,
+	}
+	rest = rest[valueStart:]
+
+	if strings.HasPrefix(rest, `"`) || strings.HasPrefix(rest, "'") {
+		line.quote = rest[:1]
+		end := closingQuote(rest[1:], line.quote)
+
+		if end < 0 {
+			return nil, errors.New("multi-line values are not supported")
+		}
+
+		line.rawValue = rest[1 : end+1]
+		line.after = rest[end+2:]
+	} else if comment := inlineComment(rest); comment == 0 && valueStart > 0 {
+		// An empty value followed by a comment, the whitespace is kept in front of the comment
+		line.before = raw[:separator+1]
+		line.after = raw[separator+1:]
+	} else {
+		if comment > 0 {
+			rest = rest[:comment]
+		}
+
+		line.rawValue = strings.TrimRight(rest, " \t")
+		line.after = raw[len(line.before)+len(line.rawValue):]
+	}
+
+	if line.quote == `"` {
+		line.value = unescapeDotenv(line.rawValue)
+	} else {
+		line.value = line.rawValue
+	}
+
+	return line, nil
+}
+
+// inlineComment returns the index of a comment within an unquoted dotenv value or -1, the `#` of
+// a comment follows whitespace, so values like `pa#ss` are kept as they are
+func inlineComment(s string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t') {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// unescapeDotenv unescapes the value of double quoted dotenv values
+func unescapeDotenv(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n").Replace(s)
+}
+
+func escapeDotenv(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// closingQuote returns the index of the closing quote, double quotes can be escaped by a backslash
+func closingQuote(s string, quote string) int {
+	for i := 0; i < len(s); i++ {
+		if quote == `"` && s[i] == '\\' {
+			i++
+		} else if s[i] == quote[0] {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// parsePropertiesLine parses lines like `key=value`, `key: value` or `key value`
+func parsePropertiesLine(raw string) (*flatLine, error) {
+	trimmed := strings.TrimLeft(raw, " \t\f")
+
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "!") {
+		return &flatLine{raw: raw}, nil
+	}
+
+	keyStart := len(raw) - len(trimmed)
+	keyEnd := keyStart
+
+	for keyEnd < len(raw) && !strings.ContainsRune("=: \t\f", rune(raw[keyEnd])) {
+		if raw[keyEnd] == '\\' {
+			keyEnd++
+		}
+		keyEnd++
+	}
+
+	if keyEnd > len(raw) {
+		keyEnd = len(raw)
+	}
+
+	valueStart := keyEnd
+	for valueStart < len(raw) && strings.ContainsRune(" \t\f", rune(raw[valueStart])) {
+		valueStart++
+	}
+
+	if valueStart < len(raw) && (raw[valueStart] == '=' || raw[valueStart] == ':') {
+		valueStart++
+		for valueStart < len(raw) && strings.ContainsRune(" \t\f", rune(raw[valueStart])) {
+			valueStart++
+		}
+	}
+
+	rawValue := raw[valueStart:]
+
+	if trailing := len(rawValue) - len(strings.TrimRight(rawValue, `\`)); trailing%2 == 1 {
+		return nil, errors.New("multi-line values are not supported")
+	}
+
+	return &flatLine{
+		raw:      raw,
+		entry:    true,
+		before:   raw[:valueStart],
+		key:      unescapeProperty(raw[keyStart:keyEnd]),
+		rawValue: rawValue,
+		value:    unescapeProperty(rawValue),
+	}, nil
+}
+
+func unescapeProperty(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+4 < len(s) {
+				if r, err := strconv.ParseUint(s[i+1:i+5], 16, 32); err == nil {
+					b.WriteRune(rune(r))
+					i += 4
+					continue
+				}
+			}
+			b.WriteByte('u')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String()
+}
+
+func escapeProperty(s string) string {
+	var b strings.Builder
+
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == ' ' && i == 0:
+			b.WriteString(`\ `)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,256 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+var dotenvImport = []byte(`# Database
+DB_USER=john
+export DB_PASSWORD="sec\"ret"
+API_TOKEN='token' # inline comment
+EMPTY=
+`)
+
+var dotenvTransformedExport = []byte(`# Database
+DB_USER=ENC:john
+export DB_PASSWORD="ENC:sec\"ret"
+API_TOKEN='ENC:token' # inline comment
+EMPTY=ENC:
+# sealit:
+#     version: 1
+#     name: ""
+#     namespace: ""
+#     sealedAt: ""
+#     cert: ""
+`)
+
+var propertiesImport = []byte(`# Database
+db.user=john
+db.password : sec\tret
+api\ token token
+! comment
+`)
+
+var propertiesTransformedExport = []byte(`# Database
+db.user=ENC:john
+db.password : ENC:sec\tret
+api\ token token
+! comment
+# sealit:
+#     version: 1
+#     name: ""
+#     namespace: ""
+#     sealedAt: ""
+#     cert: ""
+`)
+
+func TestDotenvValues(t *testing.T) {
+	f, err := newFlatFile(dotenvImport, dotenvFormat, sealitYamlKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]string{}
+	f.ApplyFuncToValues(func(path string, key *yaml.Node, value *yaml.Node) error {
+		values[path] = value.Value
+		return nil
+	})
+
+	expected := map[string]string{"DB_USER": "john", "DB_PASSWORD": `sec"ret`, "API_TOKEN": "token", "EMPTY": ""}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Values were incorrect, got: %v, want: %v.", values, expected)
+	}
+}
+
+func TestDotenvTransformingOfValues(t *testing.T) {
+	f, _ := newFlatFile(dotenvImport, dotenvFormat, sealitYamlKey)
+
+	f.ApplyFuncToValues(func(path string, key *yaml.Node, value *yaml.Node) error {
+		value.SetString(fmt.Sprintf("ENC:%s", value.Value))
+		return nil
+	})
+
+	d, _ := f.Export()
+
+	if !reflect.DeepEqual(d, dotenvTransformedExport) {
+		t.Errorf("Sealed dotenv was incorrect, got: \n%s\n, want: \n%s\n.", d, dotenvTransformedExport)
+	}
+}
+
+func TestDotenvImportExportOfTransformedFile(t *testing.T) {
+	f, err := newFlatFile(dotenvTransformedExport, dotenvFormat, sealitYamlKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, _ := f.Export()
+
+	if !reflect.DeepEqual(d, dotenvTransformedExport) {
+		t.Errorf("Sealed dotenv was incorrect, got: \n%s\n, want: \n%s\n.", d, dotenvTransformedExport)
+	}
+}
+
+func TestDotenvInlineComment(t *testing.T) {
+	f, err := newFlatFile([]byte("DB_PASSWORD=secret # rotated\nAPI_TOKEN=to#ken\nPIN=#1234\nEMPTY= # unset\n"), dotenvFormat, sealitYamlKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]string{}
+	f.ApplyFuncToValues(func(path string, key *yaml.Node, value *yaml.Node) error {
+		values[path] = value.Value
+		value.SetString(fmt.Sprintf("ENC:%s", value.Value))
+		return nil
+	})
+
+	expected := map[string]string{"DB_PASSWORD": "secret", "API_TOKEN": "to#ken", "PIN": "#1234", "EMPTY": ""}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Values were incorrect, got: %v, want: %v.", values, expected)
+	}
+
+	d, _ := f.Export()
+	exported := "DB_PASSWORD=ENC:secret # rotated\nAPI_TOKEN=ENC:to#ken\nPIN=ENC:#1234\nEMPTY=ENC: # unset\n"
+
+	if !strings.HasPrefix(string(d), exported) {
+		t.Errorf("Sealed dotenv was incorrect, got: \n%s\n, want: \n%s\n.", d, exported)
+	}
+}
+
+func TestDotenvMultiLineValue(t *testing.T) {
+	_, err := newFlatFile([]byte("KEY=\"first\nsecond\"\n"), dotenvFormat, sealitYamlKey)
+
+	if err == nil || err.Error() != "in line 1 multi-line values are not supported" {
+		t.Errorf("Error was incorrect, got: %v, want: %s.", err, "in line 1 multi-line values are not supported")
+	}
+}
+
+func TestPropertiesValues(t *testing.T) {
+	f, err := newFlatFile(propertiesImport, propertiesFormat, sealitYamlKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]string{}
+	f.ApplyFuncToValues(func(path string, key *yaml.Node, value *yaml.Node) error {
+		values[path] = value.Value
+		return nil
+	})
+
+	expected := map[string]string{"db.user": "john", "db.password": "sec\tret", "api token": "token"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Values were incorrect, got: %v, want: %v.", values, expected)
+	}
+}
+
+func TestPropertiesTransformingOfValues(t *testing.T) {
+	f, _ := newFlatFile(propertiesImport, propertiesFormat, sealitYamlKey)
+
+	f.ApplyFuncToValues(func(path string, key *yaml.Node, value *yaml.Node) error {
+		if path != "api token" {
+			value.SetString(fmt.Sprintf("ENC:%s", value.Value))
+		}
+		return nil
+	})
+
+	d, _ := f.Export()
+
+	if !reflect.DeepEqual(d, propertiesTransformedExport) {
+		t.Errorf("Sealed properties were incorrect, got: \n%s\n, want: \n%s\n.", d, propertiesTransformedExport)
+	}
+}
+
+func TestPropertiesMultiLineValue(t *testing.T) {
+	_, err := newFlatFile([]byte("key=first \\\n  second\n"), propertiesFormat, sealitYamlKey)
+
+	if err == nil || err.Error() != "in line 1 multi-line values are not supported" {
+		t.Errorf("Error was incorrect, got: %v, want: %s.", err, "in line 1 multi-line values are not supported")
+	}
+}
+
+func TestLoadFlatFileMetadata(t *testing.T) {
+	d := []byte(`KEY=ENC:abc
+# sealing-info:
+#     version: 1
+#     name: app
+#     namespace: default
+#     sealedAt: ""
+#     cert: ""
+#     secrets:
+#         KEY:
+#             sealedAt: "2020-01-01T00:00:00Z"
+#             cert: SHA256:abc
+#             scope: strict
+`)
+
+	f, err := newFlatFile(d, dotenvFormat, "sealing-info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Metadata.Name != "app" || f.Metadata.Namespace != "default" || f.Metadata.Secrets["KEY"].Scope != "strict" {
+		t.Errorf("Metadata was incorrect, got: %+v.", f.Metadata)
+	}
+
+	exported, _ := f.Export()
+	if !reflect.DeepEqual(exported, d) {
+		t.Errorf("Exported dotenv was incorrect, got: \n%s\n, want: \n%s\n.", exported, d)
+	}
+}
+
+func TestFlatFileCommentAfterMetadata(t *testing.T) {
+	d := []byte(`KEY=ENC:abc
+# sealit:
+#     version: 1
+#     name: app
+#     namespace: default
+#     sealedAt: ""
+#     cert: ""
+#  rotated monthly, see the runbook
+#     owned by the platform team
+`)
+
+	f, err := newFlatFile(d, dotenvFormat, sealitYamlKey)
+	if err != nil {
+		t.Fatalf("Loading was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if f.Metadata.Name != "app" || f.Metadata.Namespace != "default" {
+		t.Errorf("Metadata was incorrect, got: %+v.", f.Metadata)
+	}
+
+	exported, _ := f.Export()
+	expected := `KEY=ENC:abc
+#  rotated monthly, see the runbook
+#     owned by the platform team
+# sealit:
+#     version: 1
+#     name: app
+#     namespace: default
+#     sealedAt: ""
+#     cert: ""
+`
+
+	if string(exported) != expected {
+		t.Errorf("Exported dotenv was incorrect, got: \n%s\n, want: \n%s\n.", exported, expected)
+	}
+}
+
+func TestPathOfFlatFileManipulationError(t *testing.T) {
+	f, _ := newFlatFile(dotenvImport, dotenvFormat, sealitYamlKey)
+
+	err := f.ApplyFuncToValues(func(path string, key *yaml.Node, value *yaml.Node) error {
+		if path == "API_TOKEN" {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+
+	if err == nil || err.Error() != "at key API_TOKEN failed" {
+		t.Errorf("Error was incorrect, got: %v, want: %s.", err, "at key API_TOKEN failed")
+	}
+}
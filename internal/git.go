@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// git runs a git command in the current directory and returns its stdout
+func git(args ...string) ([]byte, error) {
+	log.Printf("[DEBUG] Run git %s", strings.Join(args, " "))
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// gitHooksDir returns the path of the hooks directory of the current repository
+func gitHooksDir() (string, error) {
+	out, err := git("rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// gitStagedFiles returns the files of the current directory which are part of the git index,
+// files of subdirectories are omitted
+func gitStagedFiles() ([]string, error) {
+	out, err := git("ls-files", "--cached", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, file := range strings.Split(string(out), "\x00") {
+		if file != "" && !strings.Contains(file, "/") {
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+// gitReadStagedFile returns the content of the file as it is staged in the git index
+func gitReadStagedFile(path string) ([]byte, error) {
+	return git("show", fmt.Sprintf(":./%s", path))
+}
+
+// gitFileExistsAtRevision checks if the file is part of the given revision
+func gitFileExistsAtRevision(revision string, path string) bool {
+	_, err := git("cat-file", "-e", fmt.Sprintf("%s:./%s", revision, path))
+	return err == nil
+}
+
+// gitReadFileAtRevision returns the content of the file at the given revision
+func gitReadFileAtRevision(revision string, path string) ([]byte, error) {
+	return git("show", fmt.Sprintf("%s:./%s", revision, path))
+}
+
+// gitFilesAtRevisions returns the sorted files of the current directory which are part of any of the given
+// revisions, files of subdirectories are omitted
+func gitFilesAtRevisions(revisions ...string) ([]string, error) {
+	found := map[string]bool{}
+
+	for _, revision := range revisions {
+		out, err := git("ls-tree", "-z", revision)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range strings.Split(string(out), "\x00") {
+			// Every entry is formatted as `<mode> <type> <object>\t<file>`
+			fields := strings.SplitN(entry, "\t", 2)
+			if len(fields) == 2 && strings.Contains(fields[0], " blob ") {
+				found[fields[1]] = true
+			}
+		}
+	}
+
+	files := make([]string, 0, len(found))
+	for file := range found {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// gitChangedFiles returns all files of the current directory which were added or modified
+// since the given revision, including untracked files
+func gitChangedFiles(revision string) (map[string]bool, error) {
+	changed, err := git("diff", "--name-only", "--relative", "--diff-filter=ACMR", revision, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	untracked, err := git("ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]bool{}
+	for _, file := range strings.Split(string(changed)+string(untracked), "\n") {
+		if file != "" {
+			files[file] = true
+		}
+	}
+
+	return files, nil
+}
+
+// gitignore adds the path to the .gitignore of the current directory, unless it is listed already
+func gitignore(path string) error {
+	d, err := ioutil.ReadFile(".gitignore")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	entry := "/" + filepath.ToSlash(filepath.Clean(path))
+	for _, line := range strings.Split(string(d), "\n") {
+		if line = strings.TrimSpace(line); line == entry || line == strings.TrimPrefix(entry, "/") {
+			return nil
+		}
+	}
+
+	log.Printf("[DEBUG] Add %s to .gitignore", entry)
+
+	if len(d) > 0 && !bytes.HasSuffix(d, []byte("\n")) {
+		d = append(d, '\n')
+	}
+
+	return ioutil.WriteFile(".gitignore", append(d, []byte(entry+"\n")...), 0644)
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+// testGitRepo creates a temporary git repository and changes into it
+func testGitRepo(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "sealit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := exec.Command("git", "init").CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %s", out)
+	}
+
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestReadStagedFile(t *testing.T) {
+	defer testGitRepo(t)()
+
+	ioutil.WriteFile("values.dev.yaml", []byte("password: ENC:staged\n"), 0644)
+	git("add", "values.dev.yaml")
+	ioutil.WriteFile("values.dev.yaml", []byte("password: secret\n"), 0644)
+
+	d, err := gitReadStagedFile("values.dev.yaml")
+
+	if err != nil {
+		t.Fatalf("Reading staged file failed, got an error %s.", err.Error())
+	}
+
+	if string(d) != "password: ENC:staged\n" {
+		t.Errorf("Staged content was incorrect, got: %s, want: %s.", d, "password: ENC:staged\n")
+	}
+}
+
+func TestStagedFiles(t *testing.T) {
+	defer testGitRepo(t)()
+
+	os.Mkdir("charts", 0755)
+	ioutil.WriteFile("values.dev.yaml", []byte("password: secret\n"), 0644)
+	ioutil.WriteFile("values.prod.yaml", []byte("password: secret\n"), 0644)
+	ioutil.WriteFile("charts/values.yaml", []byte("password: secret\n"), 0644)
+	git("add", "values.dev.yaml", "charts/values.yaml")
+	os.Remove("values.dev.yaml")
+
+	files, err := gitStagedFiles()
+	if err != nil {
+		t.Fatalf("Listing staged files was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if !reflect.DeepEqual(files, []string{"values.dev.yaml"}) {
+		t.Errorf("Staged files were incorrect, got: %v, want: %v.", files, []string{"values.dev.yaml"})
+	}
+}
+
+func TestReadFileAtRevision(t *testing.T) {
+	defer testGitRepo(t)()
+
+	ioutil.WriteFile("values.dev.yaml", []byte("password: ENC:committed\n"), 0644)
+	git("add", "values.dev.yaml")
+	git("-c", "user.name=sealit", "-c", "user.email=sealit@example.org", "commit", "-m", "add values")
+	ioutil.WriteFile("values.dev.yaml", []byte("password: secret\n"), 0644)
+
+	if !gitFileExistsAtRevision("HEAD", "values.dev.yaml") {
+		t.Error("Committed file was not found at revision HEAD.")
+	}
+
+	if gitFileExistsAtRevision("HEAD", "values.prod.yaml") {
+		t.Error("Unknown file was found at revision HEAD.")
+	}
+
+	d, err := gitReadFileAtRevision("HEAD", "values.dev.yaml")
+
+	if err != nil || string(d) != "password: ENC:committed\n" {
+		t.Errorf("Committed content was incorrect, got: %s, want: %s.", d, "password: ENC:committed\n")
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	defer testGitRepo(t)()
+
+	ioutil.WriteFile("values.dev.yaml", []byte("password: ENC:committed\n"), 0644)
+	ioutil.WriteFile("values.prod.yaml", []byte("password: ENC:committed\n"), 0644)
+	git("add", ".")
+	git("-c", "user.name=sealit", "-c", "user.email=sealit@example.org", "commit", "-m", "add values")
+	ioutil.WriteFile("values.dev.yaml", []byte("password: secret\n"), 0644)
+	ioutil.WriteFile("values.test.yaml", []byte("password: secret\n"), 0644)
+
+	files, err := gitChangedFiles("HEAD")
+
+	if err != nil {
+		t.Fatalf("Listing changed files failed, got an error %s.", err.Error())
+	}
+
+	expected := map[string]bool{"values.dev.yaml": true, "values.test.yaml": true}
+
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Changed files were incorrect, got: %v, want: %v.", files, expected)
+	}
+}
+
+func TestFilesAtRevisions(t *testing.T) {
+	defer testGitRepo(t)()
+
+	commit := func() { git("-c", "user.name=sealit", "-c", "user.email=sealit@example.org", "commit", "-m", "values") }
+
+	os.Mkdir("charts", 0755)
+	ioutil.WriteFile("values.dev.yaml", []byte("password: ENC:committed\n"), 0644)
+	ioutil.WriteFile("charts/values.yaml", []byte("password: ENC:committed\n"), 0644)
+	git("add", ".")
+	commit()
+	git("rm", "values.dev.yaml")
+	ioutil.WriteFile("values.prod.yaml", []byte("password: ENC:committed\n"), 0644)
+	git("add", ".")
+	commit()
+
+	files, err := gitFilesAtRevisions("HEAD~1", "HEAD")
+
+	if err != nil {
+		t.Fatalf("Listing files failed, got an error %s.", err.Error())
+	}
+
+	expected := []string{"values.dev.yaml", "values.prod.yaml"}
+
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Files were incorrect, got: %v, want: %v.", files, expected)
+	}
+}
+
+func TestGitignore(t *testing.T) {
+	defer testGitRepo(t)()
+
+	ioutil.WriteFile(".gitignore", []byte("/bin"), 0644)
+	gitignore("secrets/tls.key")
+	gitignore("./secrets/tls.key")
+
+	d, _ := ioutil.ReadFile(".gitignore")
+
+	if string(d) != "/bin\n/secrets/tls.key\n" {
+		t.Errorf("Gitignore was incorrect, got: %q.", d)
+	}
+}
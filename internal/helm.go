@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+
+	ssv1alpha1 "github.com/bitnami-labs/sealed-secrets/pkg/apis/sealed-secrets/v1alpha1"
+	"gopkg.in/yaml.v3"
+)
+
+// HelmPostRender reads the manifests rendered by Helm and turns Secrets and SealedSecrets
+// with sealed values into SealedSecrets. The prefixes of all sealing rule sets are recognized.
+func HelmPostRender(sealitconfig string, in io.Reader, out io.Writer) (err error) {
+	ruleSets, err := loadSealingRuleSets(sealitconfig)
+	if err != nil {
+		return err
+	}
+
+	d, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	d, err = postRenderManifests(d, ruleSets)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(d)
+
+	return err
+}
+
+// postRenderManifests converts the documents with values sealed by any of the rule sets,
+// without rule sets values with the default prefix are sealed
+func postRenderManifests(d []byte, ruleSets []SealingRuleSet) ([]byte, error) {
+	docs, err := decodeManifests(d)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, doc := range docs {
+		switch manifestKind(doc) {
+		case secretKind:
+			err = postRenderSecret(doc, ruleSets)
+		case sealedSecretKind:
+			err = postRenderSealedSecret(doc, ruleSets)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("in document %d %s", i+1, err.Error())
+		}
+	}
+
+	return encodeManifests(docs)
+}
+
+// postRenderSecret replaces a Secret with sealed values by a SealedSecret,
+// Secrets without sealed values are kept
+func postRenderSecret(doc *yaml.Node, ruleSets []SealingRuleSet) error {
+	var secret secretManifest
+	if err := doc.Content[0].Decode(&secret); err != nil {
+		return err
+	}
+
+	encryptedData := map[string]string{}
+	var plainKeys []string
+	var prefixes []string
+
+	for key, value := range secret.Data {
+		if _, ok := sealedPrefix(ruleSets, value); !ok {
+			// Sealed values are usually base64 encoded via `b64enc` in the template
+			if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+				value = string(decoded)
+			}
+		}
+
+		if prefix, ok := sealedPrefix(ruleSets, value); ok {
+			encryptedData[key] = strings.TrimPrefix(value, prefix)
+			prefixes = append(prefixes, prefix)
+		} else {
+			plainKeys = append(plainKeys, key)
+		}
+	}
+
+	for key, value := range secret.StringData {
+		if prefix, ok := sealedPrefix(ruleSets, value); ok {
+			encryptedData[key] = strings.TrimPrefix(value, prefix)
+			prefixes = append(prefixes, prefix)
+		} else {
+			plainKeys = append(plainKeys, key)
+		}
+	}
+
+	if len(encryptedData) == 0 {
+		log.Printf("[DEBUG] Keep Secret `%s` as it has no sealed values", secret.Metadata.Name)
+		return nil
+	}
+
+	if len(plainKeys) > 0 {
+		sort.Strings(plainKeys)
+		return fmt.Errorf("Secret `%s` has sealed values, but the values of `%s` are not sealed", secret.Metadata.Name, strings.Join(plainKeys, "`, `"))
+	}
+
+	metadata := secret.Metadata
+	if !hasScopeAnnotation(metadata.Annotations) && len(ruleSets) > 0 {
+		sort.Strings(prefixes)
+		scope := ruleSetScope(ruleSets, metadata, prefixes[0])
+		log.Printf("[DEBUG] Use scope %v of the sealing rule for Secret `%s`", scope, metadata.Name)
+		metadata.Annotations = ssv1alpha1.UpdateScopeAnnotations(metadata.Annotations, scope)
+	}
+
+	log.Printf("[DEBUG] Replace Secret `%s` by a SealedSecret", metadata.Name)
+
+	return replaceManifest(doc, sealedSecretFor(metadata, secret.Type, encryptedData))
+}
+
+// postRenderSealedSecret strips the prefix of the encrypted data and
+// sets the scope annotations on the metadata and the template
+func postRenderSealedSecret(doc *yaml.Node, ruleSets []SealingRuleSet) error {
+	root := doc.Content[0]
+	var prefixes []string
+
+	if spec := getValue(root, "spec"); spec != nil {
+		if encryptedData := getValue(spec, "encryptedData"); encryptedData != nil && encryptedData.Kind == yaml.MappingNode {
+			for i := 1; i < len(encryptedData.Content); i = i + 2 {
+				value := encryptedData.Content[i]
+				if prefix, ok := sealedPrefix(ruleSets, value.Value); ok {
+					log.Printf("[DEBUG] Strip prefix of `%s`", encryptedData.Content[i-1].Value)
+					value.SetString(strings.TrimPrefix(value.Value, prefix))
+					prefixes = append(prefixes, prefix)
+				}
+			}
+		}
+	}
+
+	var sealedSecret sealedSecretManifest
+	if err := root.Decode(&sealedSecret); err != nil {
+		return err
+	}
+
+	metadata := sealedSecret.Metadata
+	templateAnnotations := sealedSecret.Spec.Template.Metadata.Annotations
+
+	var scope ssv1alpha1.SealingScope
+	if hasScopeAnnotation(metadata.Annotations) {
+		scope = manifestScope(metadata.Annotations)
+	} else if hasScopeAnnotation(templateAnnotations) {
+		scope = manifestScope(templateAnnotations)
+	} else if len(ruleSets) > 0 && len(prefixes) > 0 {
+		sort.Strings(prefixes)
+		scope = ruleSetScope(ruleSets, metadata, prefixes[0])
+	} else {
+		scope = ssv1alpha1.StrictScope
+	}
+
+	if scope == ssv1alpha1.StrictScope {
+		return nil
+	}
+
+	// The controller reads the scope from the metadata, kubeseal keeps it in the template as well
+	setScopeAnnotations(mappingValue(root, "metadata"), scope)
+	setScopeAnnotations(mappingValue(mappingValue(mappingValue(root, "spec"), "template"), "metadata"), scope)
+
+	return nil
+}
+
+// sealedPrefix returns the longest prefix of the rule sets the value starts with,
+// without rule sets the default prefix is used
+func sealedPrefix(ruleSets []SealingRuleSet, value string) (string, bool) {
+	if len(ruleSets) == 0 {
+		ruleSets = []SealingRuleSet{{}}
+	}
+
+	prefix := ""
+	for _, srs := range ruleSets {
+		if p := srs.GetEncryptionPrefix(); strings.HasPrefix(value, p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+
+	return prefix, prefix != ""
+}
+
+// ruleSetScope returns the scope of the first rule set with the prefix, whose name and namespace fit the
+// metadata, or otherwise of the first rule set with the prefix
+func ruleSetScope(ruleSets []SealingRuleSet, metadata manifestMetadata, prefix string) ssv1alpha1.SealingScope {
+	var match *SealingRuleSet
+
+	for i, srs := range ruleSets {
+		if srs.GetEncryptionPrefix() != prefix {
+			continue
+		}
+
+		if (srs.Name == "" || srs.Name == metadata.Name) && (srs.Namespace == "" || metadata.Namespace == "" || srs.Namespace == metadata.Namespace) {
+			match = &ruleSets[i]
+			break
+		} else if match == nil {
+			match = &ruleSets[i]
+		}
+	}
+
+	if match == nil {
+		return ssv1alpha1.StrictScope
+	}
+
+	return (&Metadata{Name: match.Name, Namespace: match.Namespace}).getScope()
+}
+
+// hasScopeAnnotation checks if the scope is annotated explicitly
+func hasScopeAnnotation(annotations map[string]string) bool {
+	_, clusterWide := annotations[ssv1alpha1.SealedSecretClusterWideAnnotation]
+	_, namespaceWide := annotations[ssv1alpha1.SealedSecretNamespaceWideAnnotation]
+
+	return clusterWide || namespaceWide
+}
+
+// setScopeAnnotations sets the annotations of the scope, while keeping all other annotations
+func setScopeAnnotations(metadata *yaml.Node, scope ssv1alpha1.SealingScope) {
+	annotations := mappingValue(metadata, "annotations")
+
+	removeKey(annotations, ssv1alpha1.SealedSecretClusterWideAnnotation)
+	removeKey(annotations, ssv1alpha1.SealedSecretNamespaceWideAnnotation)
+
+	for key, value := range ssv1alpha1.UpdateScopeAnnotations(nil, scope) {
+		annotations.Content = append(annotations.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+			&yaml.Node{Kind: yaml.ScalarNode, Style: yaml.DoubleQuotedStyle, Value: value},
+		)
+	}
+}
+
+// mappingValue returns the mapping of the key and creates it if it does not exist
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if v := getValue(n, key); v != nil {
+		// An empty key like `annotations:` is a null value
+		if v.Kind != yaml.MappingNode {
+			v.Kind, v.Tag, v.Value = yaml.MappingNode, "!!map", ""
+		}
+
+		return v
+	}
+
+	v := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, v)
+
+	return v
+}
@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+
+	ssv1alpha1 "github.com/bitnami-labs/sealed-secrets/pkg/apis/sealed-secrets/v1alpha1"
+	"gopkg.in/yaml.v3"
+)
+
+var renderedManifests = []byte(`---
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  password: ENC:not-a-secret
+---
+# Source: app/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+  labels:
+    app.kubernetes.io/name: app
+  annotations:
+    sealedsecrets.bitnami.com/namespace-wide: "true"
+type: Opaque
+data:
+  password: RU5DOkFnQnkzaTRPSlNXSytQaVR5U1laWkE=
+stringData:
+  pin: ENC:AgCx7Dc5
+---
+# Source: app/templates/sealedsecret.yaml
+apiVersion: bitnami.com/v1alpha1
+kind: SealedSecret
+metadata:
+  name: other
+  annotations:
+    sealedsecrets.bitnami.com/cluster-wide: "true"
+spec:
+  template:
+    metadata:
+      name: other
+  encryptedData:
+    token: ENC:AgDa3kd8
+`)
+
+func TestPostRenderManifests(t *testing.T) {
+	d, err := postRenderManifests(renderedManifests, nil)
+	if err != nil {
+		t.Fatalf("Post rendering was unsuccessful, got an error %s.", err.Error())
+	}
+
+	docs, _ := decodeManifests(d)
+	if len(docs) != 3 || manifestKind(docs[1]) != sealedSecretKind || manifestKind(docs[2]) != sealedSecretKind {
+		t.Fatalf("Documents were incorrect, got: \n%s", d)
+	}
+
+	if !bytes.Contains(d, []byte("password: ENC:not-a-secret")) {
+		t.Errorf("ConfigMap was changed, got: \n%s", d)
+	}
+
+	var converted sealedSecretManifest
+	docs[1].Content[0].Decode(&converted)
+
+	if converted.Spec.EncryptedData["password"] != "AgBy3i4OJSWK+PiTySYZZA" || converted.Spec.EncryptedData["pin"] != "AgCx7Dc5" {
+		t.Errorf("Encrypted data was incorrect, got: %v.", converted.Spec.EncryptedData)
+	}
+
+	if converted.Metadata.Annotations[ssv1alpha1.SealedSecretNamespaceWideAnnotation] != "true" || converted.Spec.Template.Type != "Opaque" || converted.Spec.Template.Metadata.Labels["app.kubernetes.io/name"] != "app" {
+		t.Errorf("SealedSecret was incorrect, got: %+v.", converted)
+	}
+
+	var sealedSecret sealedSecretManifest
+	docs[2].Content[0].Decode(&sealedSecret)
+
+	if sealedSecret.Spec.EncryptedData["token"] != "AgDa3kd8" {
+		t.Errorf("Encrypted data was incorrect, got: %v.", sealedSecret.Spec.EncryptedData)
+	}
+
+	if sealedSecret.Spec.Template.Metadata.Annotations[ssv1alpha1.SealedSecretClusterWideAnnotation] != "true" {
+		t.Errorf("Scope annotation of the template is missing, got: %v.", sealedSecret.Spec.Template.Metadata.Annotations)
+	}
+}
+
+func TestPostRenderSecretWithoutSealedValues(t *testing.T) {
+	secret := []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+stringData:
+  password: plain
+`)
+
+	d, err := postRenderManifests(secret, nil)
+	if err != nil {
+		t.Fatalf("Post rendering was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if !bytes.Equal(d, secret) {
+		t.Errorf("Secret was changed, got: \n%s\n, want: \n%s\n.", d, secret)
+	}
+}
+
+func TestPostRenderSecretWithPlainValues(t *testing.T) {
+	secret := []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+stringData:
+  password: ENC:AgBy3i4O
+  username: john
+`)
+
+	_, err := postRenderManifests(secret, nil)
+
+	if err == nil || err.Error() != "in document 1 Secret `app` has sealed values, but the values of `username` are not sealed" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+}
+
+func TestPostRenderWithScopeOfSealingRules(t *testing.T) {
+	ruleSets := []SealingRuleSet{
+		{Namespace: "default"},
+		{Name: "app", Namespace: "prod", EncryptionPrefix: "prod:"},
+	}
+
+	manifests := []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+stringData:
+  password: ENC:AgBy3i4O
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+stringData:
+  password: prod:AgCx7Dc5
+---
+apiVersion: bitnami.com/v1alpha1
+kind: SealedSecret
+metadata:
+  name: other
+spec:
+  encryptedData:
+    token: ENC:AgDa3kd8
+`)
+
+	d, err := postRenderManifests(manifests, ruleSets)
+	if err != nil {
+		t.Fatalf("Post rendering was unsuccessful, got an error %s.", err.Error())
+	}
+
+	docs, _ := decodeManifests(d)
+	scopes := []ssv1alpha1.SealingScope{ssv1alpha1.NamespaceWideScope, ssv1alpha1.StrictScope, ssv1alpha1.NamespaceWideScope}
+	data := []string{"AgBy3i4O", "AgCx7Dc5", "AgDa3kd8"}
+
+	for i, doc := range docs {
+		var sealedSecret sealedSecretManifest
+		doc.Content[0].Decode(&sealedSecret)
+
+		if scope := manifestScope(sealedSecret.Metadata.Annotations); scope != scopes[i] {
+			t.Errorf("Scope of document %d was incorrect, got: %v, want: %v.", i+1, scope, scopes[i])
+		}
+
+		for _, value := range sealedSecret.Spec.EncryptedData {
+			if value != data[i] {
+				t.Errorf("Encrypted data of document %d was incorrect, got: %s, want: %s.", i+1, value, data[i])
+			}
+		}
+	}
+}
+
+func TestMappingValueOfEmptyKey(t *testing.T) {
+	var n yaml.Node
+	yaml.Unmarshal([]byte("annotations:\n"), &n)
+
+	annotations := mappingValue(n.Content[0], "annotations")
+	setScopeAnnotations(n.Content[0], ssv1alpha1.NamespaceWideScope)
+
+	if annotations.Kind != yaml.MappingNode || getValue(annotations, ssv1alpha1.SealedSecretNamespaceWideAnnotation) == nil {
+		t.Errorf("Annotations were incorrect, got: %+v.", annotations)
+	}
+}
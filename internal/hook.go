@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	hookName        = "pre-commit"
+	chainedHookName = "pre-commit.sealit-chained"
+	hookIdentifier  = "# Installed by sealit"
+)
+
+var hookTemplate = `#!/bin/sh
+%s, remove it via ` + "`sealit hook uninstall`" + `
+HOOKS_DIR=$(dirname "$0")
+if [ -x "$HOOKS_DIR/%s" ]; then
+  "$HOOKS_DIR/%s" "$@" || exit $?
+fi
+cd %s && exec sealit --config %s verify --staged
+`
+
+// InstallHook writes a pre-commit hook which verifies the staged files.
+// An already existing hook is kept and called before sealit.
+func InstallHook(sealitconfig string) (err error) {
+	hooksDir, err := gitHooksDir()
+	if err != nil {
+		return err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	config, err := filepath.Abs(sealitconfig)
+	if err != nil {
+		return err
+	}
+
+	hookPath := filepath.Join(hooksDir, hookName)
+	chainedHookPath := filepath.Join(hooksDir, chainedHookName)
+
+	if existing, err := ioutil.ReadFile(hookPath); err == nil && !isSealitHook(existing) {
+		if _, err := os.Stat(chainedHookPath); err == nil {
+			return fmt.Errorf("cannot chain existing hook %s, as %s exists already", hookPath, chainedHookPath)
+		}
+
+		log.Printf("[DEBUG] Move existing hook %s to %s", hookPath, chainedHookPath)
+		if err := os.Rename(hookPath, chainedHookPath); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return err
+	}
+
+	hook := fmt.Sprintf(hookTemplate, hookIdentifier, chainedHookName, chainedHookName, shellQuote(wd), shellQuote(config))
+
+	log.Printf("[DEBUG] Write hook %s", hookPath)
+	return ioutil.WriteFile(hookPath, []byte(hook), 0755)
+}
+
+// UninstallHook removes the sealit pre-commit hook and restores a chained hook
+func UninstallHook() (err error) {
+	hooksDir, err := gitHooksDir()
+	if err != nil {
+		return err
+	}
+
+	hookPath := filepath.Join(hooksDir, hookName)
+	chainedHookPath := filepath.Join(hooksDir, chainedHookName)
+
+	existing, err := ioutil.ReadFile(hookPath)
+	if err != nil {
+		return fmt.Errorf("no hook is installed at %s", hookPath)
+	}
+
+	if !isSealitHook(existing) {
+		return fmt.Errorf("hook %s was not installed by sealit", hookPath)
+	}
+
+	log.Printf("[DEBUG] Remove hook %s", hookPath)
+	if err := os.Remove(hookPath); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(chainedHookPath); err == nil {
+		log.Printf("[DEBUG] Restore chained hook %s", chainedHookPath)
+		return os.Rename(chainedHookPath, hookPath)
+	}
+
+	return nil
+}
+
+func isSealitHook(d []byte) bool {
+	return bytes.Contains(d, []byte(hookIdentifier))
+}
+
+func shellQuote(s string) string {
+	return fmt.Sprintf("'%s'", strings.ReplaceAll(s, "'", `'\''`))
+}
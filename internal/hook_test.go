@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallAndUninstallHook(t *testing.T) {
+	defer testGitRepo(t)()
+
+	existingHook := []byte("#!/bin/sh\nexit 0\n")
+	hookPath := filepath.Join(".git", "hooks", hookName)
+	ioutil.WriteFile(hookPath, existingHook, 0755)
+
+	if err := InstallHook(".sealit.yaml"); err != nil {
+		t.Fatalf("Installing hook failed, got an error %s.", err.Error())
+	}
+
+	hook, _ := ioutil.ReadFile(hookPath)
+	if !isSealitHook(hook) {
+		t.Errorf("Hook was not installed, got: \n%s\n", hook)
+	}
+
+	chained, _ := ioutil.ReadFile(filepath.Join(".git", "hooks", chainedHookName))
+	if string(chained) != string(existingHook) {
+		t.Errorf("Existing hook was not chained, got: \n%s\n, want: \n%s\n.", chained, existingHook)
+	}
+
+	if err := UninstallHook(); err != nil {
+		t.Fatalf("Uninstalling hook failed, got an error %s.", err.Error())
+	}
+
+	restored, _ := ioutil.ReadFile(hookPath)
+	if string(restored) != string(existingHook) {
+		t.Errorf("Existing hook was not restored, got: \n%s\n, want: \n%s\n.", restored, existingHook)
+	}
+}
+
+func TestUninstallForeignHook(t *testing.T) {
+	defer testGitRepo(t)()
+
+	ioutil.WriteFile(filepath.Join(".git", "hooks", hookName), []byte("#!/bin/sh\nexit 0\n"), 0755)
+
+	if err := UninstallHook(); err == nil {
+		t.Error("Expected an error but got non")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	q := shellQuote("it's")
+
+	if q != `'it'\''s'` {
+		t.Errorf("Quoting was incorrect, got: %s, want: %s.", q, `'it'\''s'`)
+	}
+}
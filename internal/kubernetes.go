@@ -0,0 +1,274 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Path of the kubeconfig provided via `--kubeconfig`
+var kubeConfig string
+
+// Name and namespace of the controller of the default sealed-secrets install
+const (
+	defaultControllerName      = "sealed-secrets-controller"
+	defaultControllerNamespace = "kube-system"
+)
+
+// Labels of the services and deployments of the sealed-secrets manifests and Helm charts
+var controllerSelectors = []string{
+	"app.kubernetes.io/name=sealed-secrets",
+	"name=sealed-secrets-controller",
+}
+
+// Credentials provided via flags or environment, they take precedence over the config and the kubeconfig
+var kubeCredentials struct {
+	server               string
+	token                string
+	certificateAuthority string
+	nonInteractive       bool
+}
+
+// SetKubernetesCredentials sets the server, token and CA used for connecting to Kubernetes.
+// In non interactive mode missing credentials result in an error instead of a prompt.
+func SetKubernetesCredentials(server string, token string, certificateAuthority string, nonInteractive bool) {
+	kubeCredentials.server = server
+	kubeCredentials.token = token
+	kubeCredentials.certificateAuthority = certificateAuthority
+	kubeCredentials.nonInteractive = nonInteractive
+}
+
+// restConfig returns the client config for the cluster of the source. Explicit credentials take precedence
+// over the kubeconfig, within a pod without kubeconfig the ServiceAccount of the pod is used.
+func (k KubernetesCertSource) restConfig() (*rest.Config, error) {
+	server := firstNonEmpty(kubeCredentials.server, k.Server)
+	certificateAuthority := firstNonEmpty(kubeCredentials.certificateAuthority, k.CertificateAuthority)
+	token := kubeCredentials.token
+
+	if token == "" && k.TokenFile != "" {
+		d, err := ioutil.ReadFile(k.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read token: %v", err)
+		}
+
+		token = strings.TrimSpace(string(d))
+	}
+
+	if server != "" && token != "" {
+		log.Printf("[DEBUG] Connect to %s with explicit credentials", server)
+		conf := &rest.Config{Host: server, BearerToken: token}
+		conf.TLSClientConfig.CAFile = certificateAuthority
+
+		return conf, nil
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.DefaultClientConfig = &clientcmd.DefaultClientConfig
+	if kubeConfig != "" {
+		loadingRules.ExplicitPath = kubeConfig
+	}
+
+	if kubeConfig == "" && k.Context == "" && !anyFileExists(loadingRules.GetLoadingPrecedence()) {
+		if conf, err := rest.InClusterConfig(); err == nil {
+			log.Print("[DEBUG] Connect with the ServiceAccount of the pod")
+			overrideCredentials(conf, server, token, certificateAuthority)
+
+			return conf, nil
+		}
+	}
+
+	overrides := clientcmd.ConfigOverrides{}
+
+	if k.Context != "" {
+		overrides.CurrentContext = k.Context
+	}
+
+	var clientConfig clientcmd.ClientConfig
+	if kubeCredentials.nonInteractive || !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		clientConfig = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &overrides)
+	} else {
+		clientConfig = clientcmd.NewInteractiveDeferredLoadingClientConfig(loadingRules, &overrides, os.Stdin)
+	}
+
+	conf, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	overrideCredentials(conf, server, token, certificateAuthority)
+
+	return conf, nil
+}
+
+// controller returns the namespace and name of the sealed-secrets controller service. If either is omitted the
+// cluster is searched for services with the labels of a sealed-secrets install. Of multiple services the ones
+// exposing the `http` port of the controller and selecting the pods of a controller deployment are preferred.
+func (k KubernetesCertSource) controller(client kubernetes.Interface) (string, string, error) {
+	if k.Name != "" && k.Namespace != "" {
+		return k.Namespace, k.Name, nil
+	}
+
+	log.Print("[DEBUG] Discover the sealed-secrets controller")
+	var services []v1.Service
+
+	for _, selector := range controllerSelectors {
+		list, err := client.CoreV1().Services(k.Namespace).List(metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			log.Printf("[DEBUG] Cannot list services with labels %s: %v", selector, err)
+			continue
+		}
+
+		for _, service := range list.Items {
+			if (k.Name == "" || k.Name == service.Name) && !containsService(services, service) {
+				services = append(services, service)
+			}
+		}
+	}
+
+	if len(services) == 0 {
+		namespace := firstNonEmpty(k.Namespace, defaultControllerNamespace)
+		name := firstNonEmpty(k.Name, defaultControllerName)
+
+		if service, err := client.CoreV1().Services(namespace).Get(name, metav1.GetOptions{}); err == nil {
+			services = append(services, *service)
+		} else {
+			log.Printf("[DEBUG] Cannot get service %s/%s: %v", namespace, name, err)
+		}
+	}
+
+	if len(services) > 1 {
+		services = preferServices(services, func(service v1.Service) bool {
+			for _, port := range service.Spec.Ports {
+				if port.Name == "http" {
+					return true
+				}
+			}
+
+			return false
+		})
+	}
+
+	if len(services) > 1 {
+		deployments := k.controllerDeployments(client)
+		services = preferServices(services, func(service v1.Service) bool {
+			for _, deployment := range deployments {
+				if deployment.Namespace == service.Namespace && len(service.Spec.Selector) > 0 &&
+					labels.SelectorFromSet(service.Spec.Selector).Matches(labels.Set(deployment.Spec.Template.Labels)) {
+					log.Printf("[DEBUG] Service %s selects the pods of deployment %s", service.Name, deployment.Name)
+					return true
+				}
+			}
+
+			return false
+		})
+	}
+
+	if len(services) == 0 {
+		return "", "", fmt.Errorf("cannot find the sealed-secrets controller, set `name` and `namespace` of the kubernetes source")
+	} else if len(services) > 1 {
+		var found []string
+		for _, service := range services {
+			found = append(found, service.Namespace+"/"+service.Name)
+		}
+
+		sort.Strings(found)
+		return "", "", fmt.Errorf("found multiple sealed-secrets controllers `%s`, set `name` and `namespace` of the kubernetes source", strings.Join(found, "`, `"))
+	}
+
+	log.Printf("[DEBUG] Use the sealed-secrets controller %s in namespace %s", services[0].Name, services[0].Namespace)
+
+	return services[0].Namespace, services[0].Name, nil
+}
+
+// controllerDeployments returns the deployments with the labels of a sealed-secrets install
+func (k KubernetesCertSource) controllerDeployments(client kubernetes.Interface) []appsv1.Deployment {
+	var deployments []appsv1.Deployment
+
+	for _, selector := range controllerSelectors {
+		list, err := client.AppsV1().Deployments(k.Namespace).List(metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			log.Printf("[DEBUG] Cannot list deployments with labels %s: %v", selector, err)
+			continue
+		}
+
+		deployments = append(deployments, list.Items...)
+	}
+
+	return deployments
+}
+
+// preferServices returns the services matching the condition or all services, if none matches
+func preferServices(services []v1.Service, condition func(v1.Service) bool) []v1.Service {
+	var preferred []v1.Service
+
+	for _, service := range services {
+		if condition(service) {
+			preferred = append(preferred, service)
+		}
+	}
+
+	if len(preferred) == 0 {
+		return services
+	}
+
+	return preferred
+}
+
+func containsService(services []v1.Service, service v1.Service) bool {
+	for _, s := range services {
+		if s.Namespace == service.Namespace && s.Name == service.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// overrideCredentials replaces the server, token and CA of the config by the explicit ones
+func overrideCredentials(conf *rest.Config, server string, token string, certificateAuthority string) {
+	if server != "" {
+		conf.Host = server
+	}
+
+	if token != "" {
+		conf.BearerToken = token
+		conf.BearerTokenFile = ""
+	}
+
+	if certificateAuthority != "" {
+		conf.TLSClientConfig.CAFile = certificateAuthority
+		conf.TLSClientConfig.CAData = nil
+	}
+}
+
+func anyFileExists(paths []string) bool {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var testKubeconfig = []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://kubeconfig.example.org
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: kubeconfig-token
+`)
+
+func TestRestConfigWithExplicitCredentials(t *testing.T) {
+	SetKubernetesCredentials("https://flag.example.org", "flag-token", "", true)
+	defer SetKubernetesCredentials("", "", "", false)
+
+	conf, err := KubernetesCertSource{Server: "https://config.example.org", CertificateAuthority: "ca.crt"}.restConfig()
+	if err != nil {
+		t.Fatalf("Loading the config was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if conf.Host != "https://flag.example.org" || conf.BearerToken != "flag-token" || conf.TLSClientConfig.CAFile != "ca.crt" {
+		t.Errorf("Config was incorrect, got: %+v.", conf)
+	}
+}
+
+func TestRestConfigWithTokenFile(t *testing.T) {
+	f, _ := ioutil.TempFile("", "token")
+	f.WriteString("file-token\n")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	conf, err := KubernetesCertSource{Server: "https://config.example.org", TokenFile: f.Name()}.restConfig()
+	if err != nil {
+		t.Fatalf("Loading the config was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if conf.Host != "https://config.example.org" || conf.BearerToken != "file-token" {
+		t.Errorf("Config was incorrect, got: %+v.", conf)
+	}
+}
+
+func TestRestConfigOverridesKubeconfig(t *testing.T) {
+	f, _ := ioutil.TempFile("", "kubeconfig")
+	f.Write(testKubeconfig)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	kubeConfig = f.Name()
+	defer func() { kubeConfig = "" }()
+
+	conf, err := KubernetesCertSource{}.restConfig()
+	if err != nil || conf.Host != "https://kubeconfig.example.org" || conf.BearerToken != "kubeconfig-token" {
+		t.Fatalf("Config of the kubeconfig was incorrect, got: %+v, %v.", conf, err)
+	}
+
+	SetKubernetesCredentials("", "flag-token", "", true)
+	defer SetKubernetesCredentials("", "", "", false)
+
+	conf, err = KubernetesCertSource{}.restConfig()
+	if err != nil || conf.Host != "https://kubeconfig.example.org" || conf.BearerToken != "flag-token" {
+		t.Errorf("Config was incorrect, got: %+v, %v.", conf, err)
+	}
+}
+
+func TestRestConfigNonInteractiveWithoutKubeconfig(t *testing.T) {
+	kubeConfig = "does-not-exist"
+	defer func() { kubeConfig = "" }()
+
+	SetKubernetesCredentials("", "", "", true)
+	defer SetKubernetesCredentials("", "", "", false)
+
+	if _, err := (KubernetesCertSource{}).restConfig(); err == nil {
+		t.Error("Expected an error but got non")
+	}
+}
+
+func TestDiscoverController(t *testing.T) {
+	labels := map[string]string{"app.kubernetes.io/name": "sealed-secrets"}
+	selector := map[string]string{"app.kubernetes.io/name": "sealed-secrets", "app.kubernetes.io/instance": "sealit"}
+	http := []v1.ServicePort{{Name: "http", Port: 8080}}
+	client := fake.NewSimpleClientset(
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "sealit-sealed-secrets", Namespace: "sealit", Labels: labels},
+			Spec:       v1.ServiceSpec{Ports: http, Selector: selector},
+		},
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "sealit-sealed-secrets-metrics", Namespace: "sealit", Labels: labels},
+			Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{{Name: "metrics", Port: 8081}}, Selector: selector},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "sealit-controller", Namespace: "sealit", Labels: labels},
+			Spec:       appsv1.DeploymentSpec{Template: v1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: selector}}},
+		},
+	)
+
+	namespace, name, err := KubernetesCertSource{}.controller(client)
+	if err != nil || namespace != "sealit" || name != "sealit-sealed-secrets" {
+		t.Errorf("Controller was incorrect, got: %s/%s, %v.", namespace, name, err)
+	}
+
+	client.CoreV1().Services("stale").Create(&v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "sealed-secrets", Namespace: "stale", Labels: labels},
+		Spec:       v1.ServiceSpec{Ports: http, Selector: map[string]string{"app.kubernetes.io/instance": "stale"}},
+	})
+
+	namespace, name, err = KubernetesCertSource{}.controller(client)
+	if err != nil || namespace != "sealit" || name != "sealit-sealed-secrets" {
+		t.Errorf("Controller was incorrect, got: %s/%s, %v.", namespace, name, err)
+	}
+
+	client.CoreV1().Services("other").Create(&v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "sealed-secrets", Namespace: "other", Labels: labels},
+		Spec:       v1.ServiceSpec{Ports: http, Selector: selector},
+	})
+	client.AppsV1().Deployments("other").Create(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "sealed-secrets", Namespace: "other", Labels: labels},
+		Spec:       appsv1.DeploymentSpec{Template: v1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: selector}}},
+	})
+
+	if _, _, err := (KubernetesCertSource{}).controller(client); err == nil || err.Error() != "found multiple sealed-secrets controllers `other/sealed-secrets`, `sealit/sealit-sealed-secrets`, set `name` and `namespace` of the kubernetes source" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+
+	namespace, name, err = KubernetesCertSource{Namespace: "other"}.controller(client)
+	if err != nil || namespace != "other" || name != "sealed-secrets" {
+		t.Errorf("Controller was incorrect, got: %s/%s, %v.", namespace, name, err)
+	}
+}
+
+func TestDiscoverDefaultController(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "sealed-secrets-controller", Namespace: "kube-system"}})
+
+	namespace, name, err := KubernetesCertSource{}.controller(client)
+	if err != nil || namespace != "kube-system" || name != "sealed-secrets-controller" {
+		t.Errorf("Controller was incorrect, got: %s/%s, %v.", namespace, name, err)
+	}
+
+	if _, _, err := (KubernetesCertSource{Name: "unknown"}).controller(client); err == nil {
+		t.Error("Expected an error but got non")
+	}
+}
@@ -0,0 +1,300 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+
+	ssv1alpha1 "github.com/bitnami-labs/sealed-secrets/pkg/apis/sealed-secrets/v1alpha1"
+	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	secretKind       = "Secret"
+	sealedSecretKind = "SealedSecret"
+)
+
+type manifestMetadata struct {
+	Name        string            `yaml:"name,omitempty"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type secretManifest struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   manifestMetadata  `yaml:"metadata"`
+	Type       string            `yaml:"type,omitempty"`
+	Data       map[string]string `yaml:"data,omitempty"`
+	StringData map[string]string `yaml:"stringData,omitempty"`
+}
+
+type sealedSecretManifest struct {
+	APIVersion string           `yaml:"apiVersion"`
+	Kind       string           `yaml:"kind"`
+	Metadata   manifestMetadata `yaml:"metadata"`
+	Spec       sealedSecretSpec `yaml:"spec"`
+}
+
+type sealedSecretSpec struct {
+	Template      secretTemplate    `yaml:"template"`
+	EncryptedData map[string]string `yaml:"encryptedData"`
+}
+
+type secretTemplate struct {
+	Metadata manifestMetadata `yaml:"metadata"`
+	Type     string           `yaml:"type,omitempty"`
+}
+
+// isManifest checks if the file contains Kubernetes Secret or SealedSecret resources instead of values
+func isManifest(d []byte) bool {
+	docs, err := decodeManifests(d)
+	if err != nil {
+		return false
+	}
+
+	for _, doc := range docs {
+		if kind := manifestKind(doc); kind == secretKind || kind == sealedSecretKind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sealManifests converts all Secret documents into SealedSecret documents, other documents are kept
+func sealManifests(srs *SealingRuleSet, d []byte, publicKey *rsa.PublicKey) ([]byte, error) {
+	docs, err := decodeManifests(d)
+	if err != nil {
+		return nil, err
+	}
+
+	// Documents by the namespace and name of their SealedSecret
+	names := map[string]int{}
+
+	for i, doc := range docs {
+		if manifestKind(doc) != secretKind {
+			continue
+		}
+
+		var secret secretManifest
+		if err := doc.Content[0].Decode(&secret); err != nil {
+			return nil, fmt.Errorf("in document %d %s", i+1, err.Error())
+		}
+
+		log.Printf("[DEBUG] Seal Secret `%s` of document %d", secret.Metadata.Name, i+1)
+		sealedSecret, err := newSealedSecretManifest(srs, &secret, publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("in document %d %s", i+1, err.Error())
+		}
+
+		name := sealedSecret.Metadata.Namespace + "/" + sealedSecret.Metadata.Name
+		if j, ok := names[name]; ok {
+			return nil, fmt.Errorf("documents %d and %d are both sealed as `%s`", j+1, i+1, name)
+		}
+		names[name] = i
+
+		if err := replaceManifest(doc, sealedSecret); err != nil {
+			return nil, err
+		}
+	}
+
+	return encodeManifests(docs)
+}
+
+// verifyManifests fails if any document is still a plain Secret or the encrypted data of a SealedSecret is malformed.
+// Without a public key the length of the session key is not checked.
+func verifyManifests(d []byte, publicKey *rsa.PublicKey) error {
+	docs, err := decodeManifests(d)
+	if err != nil {
+		return err
+	}
+
+	for i, doc := range docs {
+		switch manifestKind(doc) {
+		case secretKind:
+			return fmt.Errorf("document %d is a plain Secret, run `sealit seal` to convert it into a SealedSecret", i+1)
+		case sealedSecretKind:
+			var sealedSecret sealedSecretManifest
+			if err := doc.Content[0].Decode(&sealedSecret); err != nil {
+				return fmt.Errorf("in document %d %s", i+1, err.Error())
+			}
+
+			keys := make([]string, 0, len(sealedSecret.Spec.EncryptedData))
+			for key := range sealedSecret.Spec.EncryptedData {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				if err := verifyCiphertext(publicKey, sealedSecret.Spec.EncryptedData[key]); err != nil {
+					return fmt.Errorf("in document %d encrypted data of key `%s` is malformed: %s", i+1, key, err.Error())
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// newSealedSecretManifest encrypts the data of the secret like `kubeseal` does. The namespace of the sealing rule set
+// takes precedence over the one of the secret, its name is used for secrets without name only.
+func newSealedSecretManifest(srs *SealingRuleSet, secret *secretManifest, publicKey *rsa.PublicKey) (*sealedSecretManifest, error) {
+	metadata := secret.Metadata
+
+	if metadata.Name == "" {
+		metadata.Name = srs.Name
+	}
+
+	if srs.Namespace != "" {
+		metadata.Namespace = srs.Namespace
+	}
+
+	scope := manifestScope(metadata.Annotations)
+
+	if scope != ssv1alpha1.ClusterWideScope && metadata.Namespace == "" {
+		return nil, errors.New("secret must declare a namespace")
+	}
+
+	if scope == ssv1alpha1.StrictScope && metadata.Name == "" {
+		return nil, errors.New("secret must declare a name")
+	}
+
+	values := map[string][]byte{}
+
+	for key, value := range secret.Data {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("data of key `%s` is not base64 encoded", key)
+		}
+
+		values[key] = decoded
+	}
+
+	// Like Kubernetes, stringData takes precedence over data
+	for key, value := range secret.StringData {
+		values[key] = []byte(value)
+	}
+
+	label := ssv1alpha1.EncryptionLabel(metadata.Namespace, metadata.Name, scope)
+	encryptedData := map[string]string{}
+
+	for key, value := range values {
+		ciphertext, err := crypto.HybridEncrypt(rand.Reader, publicKey, value, label)
+		if err != nil {
+			return nil, err
+		}
+
+		encryptedData[key] = base64.StdEncoding.EncodeToString(ciphertext)
+		log.Printf("[DEBUG] Encrypted value of `%s`", key)
+	}
+
+	return sealedSecretFor(metadata, secret.Type, encryptedData), nil
+}
+
+// sealedSecretFor wraps the encrypted data into a SealedSecret, the metadata of the secret is kept in the template
+func sealedSecretFor(metadata manifestMetadata, secretType string, encryptedData map[string]string) *sealedSecretManifest {
+	// Never leak the plaintext of secrets, which were exported from a cluster
+	ssv1alpha1.StripLastAppliedAnnotations(metadata.Annotations)
+
+	return &sealedSecretManifest{
+		APIVersion: ssv1alpha1.SchemeGroupVersion.String(),
+		Kind:       sealedSecretKind,
+		Metadata: manifestMetadata{
+			Name:        metadata.Name,
+			Namespace:   metadata.Namespace,
+			Annotations: ssv1alpha1.UpdateScopeAnnotations(nil, manifestScope(metadata.Annotations)),
+		},
+		Spec: sealedSecretSpec{
+			Template: secretTemplate{
+				Metadata: metadata,
+				Type:     secretType,
+			},
+			EncryptedData: encryptedData,
+		},
+	}
+}
+
+// manifestScope returns the scope, which is annotated in the metadata of a resource
+func manifestScope(annotations map[string]string) ssv1alpha1.SealingScope {
+	if annotations[ssv1alpha1.SealedSecretClusterWideAnnotation] == "true" {
+		return ssv1alpha1.ClusterWideScope
+	} else if annotations[ssv1alpha1.SealedSecretNamespaceWideAnnotation] == "true" {
+		return ssv1alpha1.NamespaceWideScope
+	}
+
+	return ssv1alpha1.StrictScope
+}
+
+// replaceManifest replaces the resource of the document, while keeping the comment above it
+func replaceManifest(doc *yaml.Node, manifest interface{}) error {
+	d, err := yaml.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	var n yaml.Node
+	if err := yaml.Unmarshal(d, &n); err != nil {
+		return err
+	}
+
+	n.Content[0].Content[0].HeadComment = doc.Content[0].Content[0].HeadComment
+	doc.Content[0] = n.Content[0]
+
+	return nil
+}
+
+func manifestKind(doc *yaml.Node) string {
+	if len(doc.Content) == 0 || getValue(doc.Content[0], "apiVersion") == nil {
+		return ""
+	}
+
+	if kind := getValue(doc.Content[0], "kind"); kind != nil {
+		return kind.Value
+	}
+
+	return ""
+}
+
+func decodeManifests(d []byte) ([]*yaml.Node, error) {
+	var docs []*yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(d))
+
+	for {
+		var doc yaml.Node
+
+		if err := decoder.Decode(&doc); err == io.EOF {
+			return docs, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		docs = append(docs, &doc)
+	}
+}
+
+func encodeManifests(docs []*yaml.Node) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+
+	for _, doc := range docs {
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	ssv1alpha1 "github.com/bitnami-labs/sealed-secrets/pkg/apis/sealed-secrets/v1alpha1"
+	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
+	"gopkg.in/yaml.v3"
+)
+
+var secretManifests = []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: value
+---
+# Credentials of the database
+apiVersion: v1
+kind: Secret
+metadata:
+  name: database
+  namespace: default
+  labels:
+    app: database
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: "{}"
+    owner: team
+type: kubernetes.io/basic-auth
+data:
+  username: am9obg==
+stringData:
+  password: secret
+`)
+
+func testDecryptManifestValue(t *testing.T, key *rsa.PrivateKey, value string, label []byte) string {
+	ciphertext, _ := base64.StdEncoding.DecodeString(value)
+	fingerprint, _ := crypto.PublicKeyFingerprint(&key.PublicKey)
+
+	plaintext, err := crypto.HybridDecrypt(rand.Reader, map[string]*rsa.PrivateKey{fingerprint: key}, ciphertext, label)
+	if err != nil {
+		t.Fatalf("Decryption was unsuccessful, got an error %s.", err.Error())
+	}
+
+	return string(plaintext)
+}
+
+func TestSealManifests(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+
+	d, err := sealManifests(&SealingRuleSet{}, secretManifests, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("Sealing was unsuccessful, got an error %s.", err.Error())
+	}
+
+	docs, _ := decodeManifests(d)
+	if len(docs) != 2 || manifestKind(docs[0]) != "ConfigMap" || manifestKind(docs[1]) != sealedSecretKind {
+		t.Fatalf("Documents were incorrect, got: \n%s", d)
+	}
+
+	if !strings.Contains(string(d), "# Credentials of the database") {
+		t.Errorf("Comment of the document was not kept, got: \n%s", d)
+	}
+
+	var sealedSecret sealedSecretManifest
+	docs[1].Content[0].Decode(&sealedSecret)
+
+	if sealedSecret.Metadata.Name != "database" || sealedSecret.Metadata.Namespace != "default" || len(sealedSecret.Metadata.Annotations) != 0 {
+		t.Errorf("Metadata was incorrect, got: %+v.", sealedSecret.Metadata)
+	}
+
+	template := sealedSecret.Spec.Template
+	if template.Type != "kubernetes.io/basic-auth" || template.Metadata.Labels["app"] != "database" || template.Metadata.Annotations["owner"] != "team" {
+		t.Errorf("Template was incorrect, got: %+v.", template)
+	}
+
+	if _, ok := template.Metadata.Annotations["kubectl.kubernetes.io/last-applied-configuration"]; ok {
+		t.Error("Last applied configuration was not removed from the template")
+	}
+
+	label := []byte("default/database")
+	if v := testDecryptManifestValue(t, key, sealedSecret.Spec.EncryptedData["username"], label); v != "john" {
+		t.Errorf("Decrypted username was incorrect, got: %s, want: %s.", v, "john")
+	}
+
+	if v := testDecryptManifestValue(t, key, sealedSecret.Spec.EncryptedData["password"], label); v != "secret" {
+		t.Errorf("Decrypted password was incorrect, got: %s, want: %s.", v, "secret")
+	}
+}
+
+func TestSealManifestsWithScopeAndRuleSetOverrides(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	secret := []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: database
+  namespace: default
+  annotations:
+    sealedsecrets.bitnami.com/namespace-wide: "true"
+stringData:
+  password: secret
+`)
+
+	d, err := sealManifests(&SealingRuleSet{Namespace: "production"}, secret, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("Sealing was unsuccessful, got an error %s.", err.Error())
+	}
+
+	var sealedSecret sealedSecretManifest
+	yaml.Unmarshal(d, &sealedSecret)
+
+	if sealedSecret.Metadata.Namespace != "production" || sealedSecret.Metadata.Annotations[ssv1alpha1.SealedSecretNamespaceWideAnnotation] != "true" {
+		t.Errorf("Metadata was incorrect, got: %+v.", sealedSecret.Metadata)
+	}
+
+	if v := testDecryptManifestValue(t, key, sealedSecret.Spec.EncryptedData["password"], []byte("production")); v != "secret" {
+		t.Errorf("Decrypted password was incorrect, got: %s, want: %s.", v, "secret")
+	}
+}
+
+func TestSealManifestsWithoutNamespace(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	secret := []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: database
+stringData:
+  password: secret
+`)
+
+	_, err := sealManifests(&SealingRuleSet{}, secret, &key.PublicKey)
+
+	if err == nil || err.Error() != "in document 1 secret must declare a namespace" {
+		t.Errorf("Error was incorrect, got: %v, want: %s.", err, "in document 1 secret must declare a namespace")
+	}
+}
+
+func TestVerifyManifests(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+
+	if err := verifyManifests(secretManifests, &key.PublicKey); err == nil || err.Error() != "document 2 is a plain Secret, run `sealit seal` to convert it into a SealedSecret" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+
+	d, _ := sealManifests(&SealingRuleSet{}, secretManifests, &key.PublicKey)
+
+	if err := verifyManifests(d, &key.PublicKey); err != nil {
+		t.Errorf("Verify was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if err := verifyManifests(d, nil); err != nil {
+		t.Errorf("Verify without cert was unsuccessful, got an error %s.", err.Error())
+	}
+
+	truncated := []byte(`apiVersion: bitnami.com/v1alpha1
+kind: SealedSecret
+metadata:
+  name: database
+spec:
+  encryptedData:
+    password: AgAB
+`)
+
+	if err := verifyManifests(truncated, &key.PublicKey); err == nil || !strings.HasPrefix(err.Error(), "in document 1 encrypted data of key `password` is malformed") {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+}
+
+func TestSealManifestsWithNameOfRuleSet(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	secrets := []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: database
+stringData:
+  password: secret
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  namespace: default
+stringData:
+  token: secret
+`)
+
+	d, err := sealManifests(&SealingRuleSet{Name: "app", Namespace: "default"}, secrets, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("Sealing was unsuccessful, got an error %s.", err.Error())
+	}
+
+	docs, _ := decodeManifests(d)
+	for i, name := range []string{"database", "app"} {
+		var sealedSecret sealedSecretManifest
+		docs[i].Content[0].Decode(&sealedSecret)
+
+		if sealedSecret.Metadata.Name != name {
+			t.Errorf("Name of document %d was incorrect, got: %s, want: %s.", i+1, sealedSecret.Metadata.Name, name)
+		}
+	}
+
+	_, err = sealManifests(&SealingRuleSet{Name: "database", Namespace: "default"}, secrets, &key.PublicKey)
+	if err == nil || err.Error() != "documents 1 and 2 are both sealed as `default/database`" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+}
+
+func TestIsManifest(t *testing.T) {
+	if !isManifest(secretManifests) {
+		t.Error("Secret manifest was not detected")
+	}
+
+	if isManifest(untransformedDataImport) {
+		t.Error("Values file was detected as manifest")
+	}
+
+	if isManifest([]byte("kind: Secret\npassword: secret\n")) {
+		t.Error("Values file with a kind key was detected as manifest")
+	}
+}
@@ -0,0 +1,285 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Version of the `.sealit.yaml` format, files without a version are from before v0.5.0
+const currentConfigVersion = 1
+
+// Version of the `sealit` block of values files, blocks without a version are from before v0.5.0
+const currentMetadataVersion = 1
+
+// Sources which were defined directly below `cert` before v0.3.0
+var legacyCertSources = []string{"kubernetes", "url", "path"}
+
+// Migrate rewrites the config file and all matching values files in the current format
+func Migrate(sealitconfig string) (err error) {
+	log.Printf("[DEBUG] Load config file %s", sealitconfig)
+	configFile, err := ioutil.ReadFile(sealitconfig)
+	if err != nil {
+		return err
+	}
+
+	d, err := migrateConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Write migrated config file %s", sealitconfig)
+	if err := ioutil.WriteFile(sealitconfig, d, 0644); err != nil {
+		return err
+	}
+
+	s, err := New(sealitconfig, "", false)
+	if err != nil {
+		return err
+	}
+
+	return s.applyToEveryMatchingFile(func(srs *SealingRuleSet, f os.FileInfo) (err error) {
+		data, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			return err
+		}
+
+		if isManifest(data) {
+			log.Printf("[DEBUG] Skip file %s as SealedSecret manifests have no sealit block", f.Name())
+			return nil
+		}
+
+		log.Printf("[DEBUG] Load values file %s", f.Name())
+		vf, err := loadValuesFile(srs, f.Name(), data, srs.GetMetadataKey())
+		if err != nil {
+			return fmt.Errorf("in file %s %s", f.Name(), err.Error())
+		}
+
+		if vf.getMetadata().isEmpty() || vf.getMetadata().Version == currentMetadataVersion {
+			log.Printf("[DEBUG] Skip file %s as it is already in the current format", f.Name())
+			return nil
+		}
+
+		log.Printf("[DEBUG] Migrate file %s from version %d to %d", f.Name(), vf.getMetadata().Version, currentMetadataVersion)
+		data, err = vf.Export()
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(f.Name(), data, 0644)
+	})
+}
+
+// migrateConfig upgrades the config file, while keeping comments and order of the keys
+func migrateConfig(d []byte) ([]byte, error) {
+	var n yaml.Node
+
+	if err := yaml.Unmarshal(d, &n); err != nil {
+		return nil, err
+	}
+
+	if err := upgradeConfigNode(&n); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(&n)
+}
+
+// upgradeConfigNode transforms the yaml tree of a config file into the current format
+func upgradeConfigNode(n *yaml.Node) error {
+	if len(n.Content) == 0 || n.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+
+	root := n.Content[0]
+	version, err := getVersion(root)
+	if err != nil {
+		return err
+	}
+
+	if version > currentConfigVersion {
+		return fmt.Errorf("config version %d is not supported, update sealit to a version supporting it", version)
+	}
+
+	if version < 1 {
+		log.Print("[DEBUG] Upgrade config from the format before versioning")
+		camelCaseKeys(root, true)
+
+		if rules := getValue(root, "sealingRules"); rules != nil {
+			for _, rule := range rules.Content {
+				if cert := getValue(rule, "cert"); cert != nil && cert.Kind == yaml.MappingNode {
+					upgradeLegacyCert(cert)
+				}
+			}
+		}
+	}
+
+	setVersion(root, currentConfigVersion)
+
+	return nil
+}
+
+// upgradeLegacyCert renames the `controller` source to `kubernetes`,
+// moves sources below `sources` and `maxAge` up to the cert
+func upgradeLegacyCert(cert *yaml.Node) {
+	renameKey(cert, "controller", "kubernetes")
+
+	sources := getValue(cert, "sources")
+	if sources == nil {
+		sources = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+
+	renameKey(sources, "controller", "kubernetes")
+
+	for _, name := range legacyCertSources {
+		if source := removeKey(cert, name); source != nil {
+			sources.Content = append(sources.Content, source...)
+		}
+	}
+
+	if len(sources.Content) > 0 && getValue(cert, "sources") == nil {
+		cert.Content = append(cert.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "sources"}, sources)
+	}
+
+	if getValue(cert, "maxAge") == nil {
+		if maxAge := removeNestedKey(sources, "maxAge"); maxAge != nil {
+			cert.Content = append([]*yaml.Node{maxAge[0], maxAge[1]}, cert.Content...)
+		}
+	}
+}
+
+// upgradeMetadataNode transforms the yaml tree of a `sealit` block into the current format
+func upgradeMetadataNode(n *yaml.Node) error {
+	version, err := getVersion(n)
+	if err != nil {
+		return err
+	}
+
+	if version > currentMetadataVersion {
+		return fmt.Errorf("sealit block version %d is not supported, update sealit to a version supporting it", version)
+	}
+
+	if version < 1 {
+		log.Print("[DEBUG] Upgrade sealit block from the format before versioning")
+		// Only the keys of the block itself, as the paths below `secrets` are defined by the values
+		camelCaseKeys(n, false)
+	}
+
+	return nil
+}
+
+func getVersion(n *yaml.Node) (int, error) {
+	v := getValue(n, "version")
+	if v == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(v.Value)
+	if err != nil {
+		return 0, fmt.Errorf("version %s is not a number", v.Value)
+	}
+
+	return version, nil
+}
+
+func setVersion(n *yaml.Node, version int) {
+	if v := getValue(n, "version"); v != nil {
+		v.Value = strconv.Itoa(version)
+		return
+	}
+
+	n.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "version"},
+		{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(version)},
+	}, n.Content...)
+}
+
+func getValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i < len(n.Content); i = i + 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+func renameKey(n *yaml.Node, from string, to string) {
+	for i := 0; i < len(n.Content); i = i + 2 {
+		if n.Content[i].Value == from {
+			log.Printf("[DEBUG] Rename key `%s` to `%s`", from, to)
+			n.Content[i].Value = to
+		}
+	}
+}
+
+// removeKey removes the key from the mapping and returns the key and value nodes
+func removeKey(n *yaml.Node, key string) []*yaml.Node {
+	for i := 0; i < len(n.Content); i = i + 2 {
+		if n.Content[i].Value == key {
+			removed := []*yaml.Node{n.Content[i], n.Content[i+1]}
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+			return removed
+		}
+	}
+
+	return nil
+}
+
+// removeNestedKey removes the first occurrence of the key within the tree
+func removeNestedKey(n *yaml.Node, key string) []*yaml.Node {
+	if removed := removeKey(n, key); removed != nil {
+		return removed
+	}
+
+	for _, child := range n.Content {
+		if child.Kind == yaml.MappingNode {
+			if removed := removeNestedKey(child, key); removed != nil {
+				return removed
+			}
+		}
+	}
+
+	return nil
+}
+
+// camelCaseKeys converts snake_case keys of the mapping to camelCase
+func camelCaseKeys(n *yaml.Node, recursive bool) {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i < len(n.Content); i = i + 2 {
+			if key := toCamelCase(n.Content[i].Value); key != n.Content[i].Value {
+				renameKey(n, n.Content[i].Value, key)
+			}
+		}
+	}
+
+	if recursive {
+		for _, child := range n.Content {
+			camelCaseKeys(child, recursive)
+		}
+	}
+}
+
+func toCamelCase(s string) string {
+	parts := strings.Split(s, "_")
+
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			r := []rune(parts[i])
+			r[0] = unicode.ToUpper(r[0])
+			parts[i] = string(r)
+		}
+	}
+
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+var legacyConfig = []byte(`
+sealing_rules:
+  - file_regex: \.dev\.yaml$
+    name: mysecret
+    namespace: default
+    secrets_regex: (password|pin)$
+    cert:
+      controller:
+        context: docker-desktop
+        name: sealit-sealed-secrets
+        namespace: kube-system
+        max_age: 720h
+`)
+
+var legacyValues = []byte(`env:
+    password: ENC:secret
+sealit:
+    name: mysecret
+    namespace: default
+    sealed_at: "2020-05-03T23:37:44+02:00"
+    cert: ""
+`)
+
+func TestLoadLegacyConfig(t *testing.T) {
+	config, err := LoadConfig(legacyConfig)
+
+	if err != nil {
+		t.Fatalf("Loading legacy config failed, got an error %s.", err.Error())
+	}
+
+	srs := config.SealingRuleSets[0]
+
+	if srs.FileRegex != "\\.dev\\.yaml$" || srs.SecretsRegex != "(password|pin)$" {
+		t.Errorf("Regex was incorrect, got: %s and %s.", srs.FileRegex, srs.SecretsRegex)
+	}
+
+	if srs.Cert.Sources.Kubernetes.Name != "sealit-sealed-secrets" {
+		t.Errorf("Kubernetes source was incorrect, got: %v.", srs.Cert.Sources.Kubernetes)
+	}
+
+	if srs.Cert.MaxAge != 720*time.Hour {
+		t.Errorf("Max age was incorrect, got: %s, want: %s.", srs.Cert.MaxAge, 720*time.Hour)
+	}
+
+	if config.Version != currentConfigVersion {
+		t.Errorf("Version was incorrect, got: %d, want: %d.", config.Version, currentConfigVersion)
+	}
+}
+
+func TestMigrateConfig(t *testing.T) {
+	d, err := migrateConfig(basicConfig)
+
+	if err != nil {
+		t.Fatalf("Migrating config failed, got an error %s.", err.Error())
+	}
+
+	if !strings.HasPrefix(string(d), "version: 1\nsealingRules:\n") {
+		t.Errorf("Migrated config was incorrect, got: \n%s\n", d)
+	}
+}
+
+func TestLoadUnsupportedConfigVersion(t *testing.T) {
+	if _, err := LoadConfig([]byte("version: 99\n")); err == nil {
+		t.Error("Expected an error but got non")
+	}
+}
+
+func TestLoadLegacyMetadata(t *testing.T) {
+	f, err := NewValueFile(legacyValues)
+
+	if err != nil {
+		t.Fatalf("Loading legacy values failed, got an error %s.", err.Error())
+	}
+
+	if f.Metadata.SealedAt != "2020-05-03T23:37:44+02:00" {
+		t.Errorf("SealedAt date was incorrect, got: %s, want: %s.", f.Metadata.SealedAt, "2020-05-03T23:37:44+02:00")
+	}
+
+	d, _ := f.Export()
+
+	if !strings.Contains(string(d), "sealit:\n    version: 1\n") || strings.Contains(string(d), "sealed_at") {
+		t.Errorf("Exported values were incorrect, got: \n%s\n", d)
+	}
+}
+
+func TestToCamelCase(t *testing.T) {
+	if c := toCamelCase("secrets_regex"); c != "secretsRegex" {
+		t.Errorf("Key was incorrect, got: %s, want: %s.", c, "secretsRegex")
+	}
+}
+
+func TestMigrateSkipsManifests(t *testing.T) {
+	defer testGitRepo(t)()
+
+	ioutil.WriteFile(".sealit.yaml", legacyConfig, 0644)
+	ioutil.WriteFile("secrets.dev.yaml", secretManifests, 0644)
+	ioutil.WriteFile("values.dev.yaml", legacyValues, 0644)
+
+	if err := Migrate(".sealit.yaml"); err != nil {
+		t.Fatalf("Migration was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if d, _ := ioutil.ReadFile("secrets.dev.yaml"); !bytes.Equal(d, secretManifests) {
+		t.Errorf("Manifest was changed, got: \n%s", d)
+	}
+
+	if d, _ := ioutil.ReadFile("values.dev.yaml"); !strings.Contains(string(d), "sealedAt:") {
+		t.Errorf("Values file was not migrated, got: \n%s", d)
+	}
+}
@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+
+	ssv1alpha1 "github.com/bitnami-labs/sealed-secrets/pkg/apis/sealed-secrets/v1alpha1"
+	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// SealValue encrypts a single value read from stdin or a hidden prompt and prints it base64 encoded.
+// The cert is read from the file or fetched from the source of the sealing rule set matching the file name.
+// Name and namespace default to the ones of the sealing rule set, the scope defaults to the narrowest possible one.
+func SealValue(sealitconfig string, kubeconfig string, rule string, certPath string, name string, namespace string, scope string, withPrefix bool) (err error) {
+	kubeConfig = kubeconfig
+
+	srs, err := sealValueRuleSetFor(sealitconfig, rule, certPath)
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		name = srs.Name
+	}
+
+	if namespace == "" {
+		namespace = srs.Namespace
+	}
+
+	label, err := sealValueLabel(name, namespace, scope)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := readSecret(os.Stdin, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	var cert []byte
+	if certPath != "" {
+		log.Printf("[DEBUG] Read cert from %s", certPath)
+		cert, err = ioutil.ReadFile(certPath)
+	} else {
+		var c string
+		c, err = srs.GetCert()
+		cert = []byte(c)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := getPublicCert(cert)
+	if err != nil {
+		return err
+	}
+
+	value, err := sealValue(publicKey, plaintext, label)
+	if err != nil {
+		return err
+	}
+
+	if withPrefix {
+		value = srs.GetEncryptionPrefix() + value
+	}
+
+	fmt.Println(value)
+
+	return nil
+}
+
+// sealValueRuleSetFor returns the sealing rule set providing the cert, name, namespace and prefix. With a cert file
+// the rule is only loaded if it was given, so the value is prefixed with the `encryptionPrefix` of the rule.
+func sealValueRuleSetFor(sealitconfig string, rule string, certPath string) (*SealingRuleSet, error) {
+	if certPath != "" && rule == "" {
+		return &SealingRuleSet{}, nil
+	}
+
+	srs, err := sealValueRuleSet(sealitconfig, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	if certPath == "" && len(srs.Targets) > 0 {
+		return nil, errors.New("the sealing rule has targets, provide the cert of a target via `--cert`")
+	}
+
+	return srs, nil
+}
+
+// sealValueRuleSet returns the sealing rule set whose file regex matches the file name or the first one
+func sealValueRuleSet(sealitconfig string, rule string) (*SealingRuleSet, error) {
+	configFile, err := ioutil.ReadFile(sealitconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := LoadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, srs := range config.SealingRuleSets {
+		if rule == "" || regexp.MustCompile(srs.FileRegex).MatchString(rule) {
+			return &config.SealingRuleSets[i], nil
+		}
+	}
+
+	if rule == "" {
+		return nil, errors.New("no sealing rule is defined, provide a cert via `--cert`")
+	}
+
+	return nil, fmt.Errorf("no sealing rule matches the file name %s", rule)
+}
+
+// sealValueLabel returns the encryption label of the scope, without a scope
+// the narrowest scope possible with the name and namespace is used
+func sealValueLabel(name string, namespace string, scope string) ([]byte, error) {
+	var sealingScope ssv1alpha1.SealingScope
+
+	if scope == "" {
+		sealingScope = (&Metadata{Name: name, Namespace: namespace}).getScope()
+	} else if err := sealingScope.Set(scope); err != nil {
+		return nil, fmt.Errorf("scope %s is not supported, use `strict`, `namespace-wide` or `cluster-wide`", scope)
+	}
+
+	if sealingScope == ssv1alpha1.StrictScope && (name == "" || namespace == "") {
+		return nil, errors.New("strict scope requires a name and a namespace")
+	}
+
+	if sealingScope == ssv1alpha1.NamespaceWideScope && namespace == "" {
+		return nil, errors.New("namespace-wide scope requires a namespace")
+	}
+
+	log.Printf("[DEBUG] Seal value for `%s/%s` with scope %s", namespace, name, sealingScope.String())
+
+	return ssv1alpha1.EncryptionLabel(namespace, name, sealingScope), nil
+}
+
+func sealValue(publicKey *rsa.PublicKey, plaintext []byte, label []byte) (string, error) {
+	ciphertext, err := crypto.HybridEncrypt(rand.Reader, publicKey, plaintext, label)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// readSecret reads the secret from a hidden prompt, if the input is a terminal.
+// Otherwise the input is read completely and a trailing newline is removed.
+func readSecret(in *os.File, prompt io.Writer) ([]byte, error) {
+	if terminal.IsTerminal(int(in.Fd())) {
+		fmt.Fprint(prompt, "Secret: ")
+		defer fmt.Fprintln(prompt)
+
+		return terminal.ReadPassword(int(in.Fd()))
+	}
+
+	d, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasSuffix(d, []byte("\r\n")) {
+		return d[:len(d)-2], nil
+	}
+
+	return bytes.TrimSuffix(d, []byte("\n")), nil
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
+)
+
+func TestSealValueLabel(t *testing.T) {
+	labels := []struct {
+		name, namespace, scope, label string
+	}{
+		{"app", "default", "", "default/app"},
+		{"", "default", "", "default"},
+		{"", "", "", ""},
+		{"app", "default", "namespace-wide", "default"},
+		{"app", "default", "cluster-wide", ""},
+	}
+
+	for _, l := range labels {
+		label, err := sealValueLabel(l.name, l.namespace, l.scope)
+		if err != nil || string(label) != l.label {
+			t.Errorf("Label was incorrect, got: %s (%v), want: %s.", label, err, l.label)
+		}
+	}
+}
+
+func TestSealValueLabelWithInvalidScope(t *testing.T) {
+	if _, err := sealValueLabel("", "default", "strict"); err == nil || err.Error() != "strict scope requires a name and a namespace" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+
+	if _, err := sealValueLabel("app", "", "namespace-wide"); err == nil || err.Error() != "namespace-wide scope requires a namespace" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+
+	if _, err := sealValueLabel("app", "default", "global"); err == nil {
+		t.Error("Expected an error but got non")
+	}
+}
+
+func TestSealValue(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+
+	value, err := sealValue(&key.PublicKey, []byte("secret!"), []byte("default/app"))
+	if err != nil {
+		t.Fatalf("Sealing was unsuccessful, got an error %s.", err.Error())
+	}
+
+	ciphertext, _ := base64.StdEncoding.DecodeString(value)
+	fingerprint, _ := crypto.PublicKeyFingerprint(&key.PublicKey)
+	plaintext, err := crypto.HybridDecrypt(rand.Reader, map[string]*rsa.PrivateKey{fingerprint: key}, ciphertext, []byte("default/app"))
+
+	if err != nil || string(plaintext) != "secret!" {
+		t.Errorf("Decrypted value was incorrect, got: %s (%v), want: %s.", plaintext, err, "secret!")
+	}
+}
+
+func TestReadSecretFromPipe(t *testing.T) {
+	secrets := map[string]string{
+		"secret\n":     "secret",
+		"secret\r\n":   "secret",
+		"secret":       "secret",
+		"two\nlines\n": "two\nlines",
+	}
+
+	for input, expected := range secrets {
+		r, w, _ := os.Pipe()
+		w.Write([]byte(input))
+		w.Close()
+
+		var prompt bytes.Buffer
+		secret, err := readSecret(r, &prompt)
+		r.Close()
+
+		if err != nil || string(secret) != expected || prompt.Len() != 0 {
+			t.Errorf("Secret was incorrect, got: %q (%v), want: %q.", secret, err, expected)
+		}
+	}
+}
+
+func TestSealValueRuleSet(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "config")
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, ".sealit.yaml")
+	ioutil.WriteFile(config, []byte(`sealingRules:
+  - fileRegex: \.dev\.yaml$
+    name: dev
+  - fileRegex: \.prod\.yaml$
+    name: prod
+`), 0644)
+
+	if srs, err := sealValueRuleSet(config, "values.prod.yaml"); err != nil || srs.Name != "prod" {
+		t.Errorf("Sealing rule was incorrect, got: %v (%v), want: %s.", srs, err, "prod")
+	}
+
+	if srs, err := sealValueRuleSet(config, ""); err != nil || srs.Name != "dev" {
+		t.Errorf("Sealing rule was incorrect, got: %v (%v), want: %s.", srs, err, "dev")
+	}
+
+	if _, err := sealValueRuleSet(config, "values.yaml"); err == nil || err.Error() != "no sealing rule matches the file name values.yaml" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+}
+
+func TestSealValueRuleSetWithCert(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "config")
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, ".sealit.yaml")
+	ioutil.WriteFile(config, []byte(`sealingRules:
+  - fileRegex: \.dev\.yaml$
+    name: dev
+    encryptionPrefix: "DEV:"
+    targets:
+      - name: eu
+`), 0644)
+
+	if srs, err := sealValueRuleSetFor(config, "values.dev.yaml", "cert.pem"); err != nil || srs.GetEncryptionPrefix() != "DEV:" || srs.Name != "dev" {
+		t.Errorf("Sealing rule was incorrect, got: %v (%v), want prefix: %s.", srs, err, "DEV:")
+	}
+
+	if srs, err := sealValueRuleSetFor(filepath.Join(dir, "missing.yaml"), "", "cert.pem"); err != nil || srs.GetEncryptionPrefix() != encodeIdentifier {
+		t.Errorf("Sealing rule was incorrect, got: %v (%v), want prefix: %s.", srs, err, encodeIdentifier)
+	}
+
+	if _, err := sealValueRuleSetFor(config, "values.dev.yaml", ""); err == nil {
+		t.Error("Expected an error but got non")
+	}
+}
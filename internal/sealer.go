@@ -1,13 +1,18 @@
 package internal
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -23,27 +28,58 @@ const (
 	validCert
 )
 
+// Default prefix of encrypted values
 const encodeIdentifier = "ENC:"
 
+// Size of the authentication tag appended by AES-GCM, even an empty secret is at least this long
+const aesGcmTagSize = 16
+
+// Prefix of values, which reference a file whose raw content is sealed
+const fileReferencePrefix = "@file:"
+
 type Sealer struct {
 	secretsRegexp *regexp.Regexp
+	prefix        string
 	publicKey     *rsa.PublicKey
+	fingerprint   string
+	sealedWithKey *rsa.PublicKey
 	label         []byte
 	metadata      *Metadata
+	files         []string
 }
 
 type Resealer struct {
 	secretsRegexp *regexp.Regexp
+	prefix        string
+	oldPrefix     string
 	publicKey     *rsa.PublicKey
+	fingerprint   string
 	privateKeys   map[string]*rsa.PrivateKey
 	label         []byte
 	newLabel      []byte
+	newMetadata   Metadata
+	metadata      *Metadata
+	outdatedOnly  bool
+	// The scope is compared once, as resealing updates the scope of the metadata
+	scopeChanged bool
+	// Fingerprints of the keys other than the current one, which decrypted values
+	historicalKeys []string
+}
+
+type Unsealer struct {
+	secretsRegexp *regexp.Regexp
+	prefix        string
+	privateKeys   map[string]*rsa.PrivateKey
+	label         []byte
 	metadata      *Metadata
 }
 
 func NewSealer(srs *SealingRuleSet, m *Metadata, fetchCert bool) (s *Sealer, err error) {
 	log.Printf("[DEBUG] Create sealer based on sealing rules %v and metadata %v", srs, m)
-	if *m == (Metadata{}) {
+	// Keep the key of the embedded cert, as already sealed values were encrypted with it
+	sealedWithKey, _ := getPublicCert([]byte(m.Cert))
+
+	if m.isEmpty() {
 		log.Printf("[DEBUG] File was never encoded before, init metadata block")
 
 		m.Name = srs.Name
@@ -56,11 +92,11 @@ func NewSealer(srs *SealingRuleSet, m *Metadata, fetchCert bool) (s *Sealer, err
 		log.Printf("[DEBUG] File has encoded values and a meta block")
 
 		if m.Name != "" && srs.Name != m.Name {
-			return nil, fmt.Errorf("old secrets are limited to secret name %s, but new name is %s. Re-encryption is needed", m.Name, srs.Name)
+			return nil, fmt.Errorf("old secrets are limited to secret name %s, but new name is %s. Run `sealit rescope` to re-encrypt them", m.Name, srs.Name)
 		}
 
 		if m.Namespace != "" && srs.Namespace != m.Namespace {
-			return nil, fmt.Errorf("old secrets are limited to secret namespace %s, but new namespace is %s. Re-encryption is needed", m.Namespace, srs.Namespace)
+			return nil, fmt.Errorf("old secrets are limited to secret namespace %s, but new namespace is %s. Run `sealit rescope` to re-encrypt them", m.Namespace, srs.Namespace)
 		}
 
 		certStatus, err := certStatus([]byte(m.Cert), srs.Cert.MaxAge)
@@ -82,40 +118,173 @@ func NewSealer(srs *SealingRuleSet, m *Metadata, fetchCert bool) (s *Sealer, err
 		return nil, err
 	}
 
+	fingerprint, err := crypto.PublicKeyFingerprint(pKey)
+
+	if err != nil {
+		return nil, err
+	}
+
 	return &Sealer{
 		secretsRegexp: srs.GetSecretsRegex(),
+		prefix:        srs.GetEncryptionPrefix(),
 		publicKey:     pKey,
+		fingerprint:   fingerprint,
+		sealedWithKey: sealedWithKey,
 		label:         m.getLabel(),
 		metadata:      m,
 	}, nil
 }
 
-func NewResealer(srs *SealingRuleSet, m *Metadata) (s *Resealer, err error) {
+// NewResealer creates a resealer, which decrypts the values with the private keys of the controller
+// and encrypts them with its current cert. With outdatedOnly set only values which were not sealed
+// with the current cert and scope are resealed. Values marked with oldPrefix are sealed again with
+// the prefix of the sealing rule set.
+func NewResealer(srs *SealingRuleSet, m *Metadata, outdatedOnly bool, oldPrefix string) (s *Resealer, err error) {
 	log.Printf("[DEBUG] Create resealer based on sealing rules %v and metadata %v", srs, m)
 
-	if (srs.Cert.Sources.Kubernetes == KubernetesCertSource{}) {
+	if srs.Cert.Sources.Kubernetes == nil {
 		return s, errors.New("resealing works only with Kubernetes cert source")
 	}
 
-	pKeys, pKey, err := srs.Cert.Sources.Kubernetes.fetchKeys()
+	pKeys, cert, err := srs.Cert.Sources.Kubernetes.fetchKeys()
+
+	if err != nil {
+		return nil, err
+	}
+
+	pKey, err := getPublicCert([]byte(cert))
+
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := crypto.PublicKeyFingerprint(pKey)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if oldPrefix == "" {
+		oldPrefix = srs.GetEncryptionPrefix()
+	}
+
+	label := m.getLabel()
+	newLabel := srs.getLabel()
+
 	return &Resealer{
 		secretsRegexp: srs.GetSecretsRegex(),
+		prefix:        srs.GetEncryptionPrefix(),
+		oldPrefix:     oldPrefix,
 		publicKey:     pKey,
+		fingerprint:   fingerprint,
+		privateKeys:   pKeys,
+		label:         label,
+		newLabel:      newLabel,
+		newMetadata: Metadata{
+			Name:      srs.Name,
+			Namespace: srs.Namespace,
+			Cert:      cert,
+		},
+		metadata:     m,
+		outdatedOnly: outdatedOnly,
+		scopeChanged: !bytes.Equal(label, newLabel),
+	}, nil
+}
+
+// NewUnsealer creates an unsealer, which decrypts the values with the private keys of the controller
+func NewUnsealer(srs *SealingRuleSet, m *Metadata) (u *Unsealer, err error) {
+	log.Printf("[DEBUG] Create unsealer based on sealing rules %v and metadata %v", srs, m)
+
+	if srs.Cert.Sources.Kubernetes == nil {
+		return u, errors.New("unsealing works only with Kubernetes cert source")
+	}
+
+	pKeys, _, err := srs.Cert.Sources.Kubernetes.fetchKeys()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Unsealer{
+		secretsRegexp: srs.GetSecretsRegex(),
+		prefix:        srs.GetEncryptionPrefix(),
 		privateKeys:   pKeys,
 		label:         m.getLabel(),
-		newLabel:      srs.getLabel(),
 		metadata:      m,
 	}, nil
 }
 
-func (s *Sealer) valueNeedsToBeSealed(key *yaml.Node, value *yaml.Node) bool {
-	if s.secretsRegexp.MatchString(key.Value) {
-		if !strings.HasPrefix(value.Value, encodeIdentifier) {
+// isSecret checks if the value has to be sealed, as its key matches the secrets regex or it references a file
+func isSecret(secretsRegexp *regexp.Regexp, m *Metadata, path string, key *yaml.Node, value *yaml.Node) bool {
+	if secretsRegexp.MatchString(key.Value) || strings.HasPrefix(value.Value, fileReferencePrefix) {
+		return true
+	}
+
+	secret, ok := m.Secrets[path]
+
+	return ok && secret.File != ""
+}
+
+// checkFileReference rejects references to files outside of the working directory,
+// as the values file and its metadata are not trusted to read or write arbitrary files
+func checkFileReference(file string) error {
+	clean := filepath.Clean(file)
+
+	if file == "" || filepath.IsAbs(file) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("referenced file %s is outside of the working directory", file)
+	}
+
+	return nil
+}
+
+// readPlaintext returns the raw bytes of a value, which are the content of a referenced file,
+// the decoded content of a `!!binary` value or the value itself
+func readPlaintext(value *yaml.Node) ([]byte, string, error) {
+	if strings.HasPrefix(value.Value, fileReferencePrefix) {
+		file := strings.TrimPrefix(value.Value, fileReferencePrefix)
+		if err := checkFileReference(file); err != nil {
+			return nil, file, err
+		}
+
+		log.Printf("[DEBUG] Read referenced file %s", file)
+		plaintext, err := ioutil.ReadFile(file)
+
+		return plaintext, file, err
+	}
+
+	if value.Tag == "!!binary" {
+		plaintext, err := base64.StdEncoding.DecodeString(value.Value)
+
+		return plaintext, "", err
+	}
+
+	return []byte(value.Value), "", nil
+}
+
+// warnAboutPlaintext warns about values, which are likely not intended to be sealed as they are
+func warnAboutPlaintext(key *yaml.Node, value *yaml.Node, plaintext []byte, file string) {
+	if len(plaintext) == 0 {
+		log.Printf("[WARNING] Value of `%s` is an empty string", key.Value)
+	} else if file == "" && value.Style&(yaml.LiteralStyle|yaml.FoldedStyle) == 0 && string(plaintext) != strings.TrimSpace(string(plaintext)) {
+		// Trailing newlines of block scalars are defined by their chomping indicator
+		log.Printf("[WARNING] Value of `%s` is padded with whitespace", key.Value)
+	}
+
+	if tag := value.ShortTag(); tag != "!!str" && tag != "!!binary" {
+		log.Printf("[WARNING] Value of `%s` is a %s, but is sealed as string, which a chart may not accept as %s", key.Value, tag, strings.TrimPrefix(tag, "!!"))
+	}
+}
+
+// setSealedValue replaces the value by the prefixed ciphertext. The tag and block style of the
+// original scalar are recorded in the metadata, as they do not apply to the sealed string.
+func setSealedValue(value *yaml.Node, prefix string, ciphertext []byte) {
+	value.SetString(fmt.Sprintf("%s%s", prefix, base64.StdEncoding.EncodeToString(ciphertext)))
+	value.Style &^= yaml.TaggedStyle | yaml.LiteralStyle | yaml.FoldedStyle
+}
+
+func (s *Sealer) valueNeedsToBeSealed(path string, key *yaml.Node, value *yaml.Node) bool {
+	if isSecret(s.secretsRegexp, s.metadata, path, key, value) {
+		if !strings.HasPrefix(value.Value, s.prefix) {
 			return true
 		}
 		log.Printf("[DEBUG] Value of `%s` was already encrypted", key.Value)
@@ -127,76 +296,231 @@ func (s *Sealer) valueNeedsToBeSealed(key *yaml.Node, value *yaml.Node) bool {
 	return false
 }
 
-func (r *Resealer) Reseal(key *yaml.Node, value *yaml.Node) error {
-	if r.secretsRegexp.MatchString(key.Value) {
-		if strings.HasPrefix(value.Value, encodeIdentifier) {
-			secret := strings.TrimPrefix(value.Value, encodeIdentifier)
-			decodedSecret, err := base64.StdEncoding.DecodeString(secret)
+func (r *Resealer) Reseal(path string, key *yaml.Node, value *yaml.Node) error {
+	if isSecret(r.secretsRegexp, r.metadata, path, key, value) {
+		var plaintext []byte
+		var file string
+		var original *yaml.Node
+		var err error
+
+		if prefix, ok := r.sealedWithPrefix(value.Value); ok {
+			if r.outdatedOnly && prefix == r.prefix && r.isUpToDate(path) {
+				log.Printf("[DEBUG] Value of `%s` is already sealed with the current cert", key.Value)
+				return nil
+			}
+
+			// Keep the raw bytes, as binary content can not be stored as string
+			var fingerprint string
+			plaintext, fingerprint, err = decryptValueWithKey(r.privateKeys, r.label, strings.TrimPrefix(value.Value, prefix))
 
 			if err != nil {
 				return err
 			}
 
-			plaintext, err := crypto.HybridDecrypt(rand.Reader, r.privateKeys, decodedSecret, r.label)
+			if fingerprint != r.fingerprint && !containsString(r.historicalKeys, fingerprint) {
+				r.historicalKeys = append(r.historicalKeys, fingerprint)
+			}
 
-			if err != nil {
+			log.Printf("[DEBUG] Decrypted value of `%s` with key %s", key.Value, fingerprint)
+		} else {
+			if plaintext, file, err = readPlaintext(value); err != nil {
 				return err
 			}
 
-			value.SetString(string(plaintext))
-
-			log.Printf("[DEBUG] Decrypted value of `%s`", key.Value)
+			copied := *value
+			original = &copied
+			warnAboutPlaintext(key, value, plaintext, file)
 		}
 
-		ciphertext, err := crypto.HybridEncrypt(rand.Reader, r.publicKey, []byte(value.Value), r.newLabel)
+		ciphertext, err := crypto.HybridEncrypt(rand.Reader, r.publicKey, plaintext, r.newLabel)
 
 		if err != nil {
 			return err
 		}
 
-		if value.Value == "" {
-			log.Printf("[WARNING] Value of `%s` is an empty string", key.Value)
-		} else if value.Value != strings.TrimSpace(value.Value) {
-			log.Printf("[WARNING] Value of `%s` is padded with whitespace", key.Value)
+		setSealedValue(value, r.prefix, ciphertext)
+		r.metadata.updateSecret(path, r.fingerprint, r.newMetadata.getScope())
+
+		// Values sealed before keep the recorded file, tag and style
+		if original != nil {
+			r.metadata.Secrets[path].File = file
+			r.metadata.Secrets[path].recordScalar(original)
 		}
 
-		encodedSecret := base64.StdEncoding.EncodeToString(ciphertext)
-		value.SetString(fmt.Sprintf("%s%s", encodeIdentifier, encodedSecret))
-		r.metadata.SealedAt = time.Now().Format(time.RFC3339)
 		log.Printf("[DEBUG] Encrypted value of `%s`", key.Value)
 	}
 
 	return nil
 }
 
-func (s *Sealer) Seal(key *yaml.Node, value *yaml.Node) error {
-	if s.valueNeedsToBeSealed(key, value) {
-		ciphertext, err := crypto.HybridEncrypt(rand.Reader, s.publicKey, []byte(value.Value), s.label)
+// UpdateMetadata binds the metadata to the scope and cert of the sealing rule set, it is called once
+// after all values of the file were resealed, as values sealed with the current cert may be skipped
+func (r *Resealer) UpdateMetadata() {
+	r.metadata.Name = r.newMetadata.Name
+	r.metadata.Namespace = r.newMetadata.Namespace
+	r.metadata.Cert = r.newMetadata.Cert
+}
+
+// Unseal decrypts the value, the content of values which referenced a file is written back to the file
+func (u *Unsealer) Unseal(path string, key *yaml.Node, value *yaml.Node) error {
+	if !isSecret(u.secretsRegexp, u.metadata, path, key, value) || !strings.HasPrefix(value.Value, u.prefix) {
+		return nil
+	}
+
+	plaintext, err := decryptValue(u.privateKeys, u.label, strings.TrimPrefix(value.Value, u.prefix))
+
+	if err != nil {
+		return err
+	}
+
+	if secret, ok := u.metadata.Secrets[path]; ok && secret.File != "" {
+		if err := checkFileReference(secret.File); err != nil {
+			return err
+		}
+
+		log.Printf("[DEBUG] Restore referenced file %s of `%s`", secret.File, key.Value)
+
+		if err := os.MkdirAll(filepath.Dir(secret.File), 0755); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(secret.File, plaintext, 0600); err != nil {
+			return err
+		}
+
+		value.SetString(fileReferencePrefix + secret.File)
+	} else {
+		// Binary content is stored as base64 encoded `!!binary` value
+		value.SetString(string(plaintext))
+	}
+
+	if secret, ok := u.metadata.Secrets[path]; ok {
+		secret.restoreScalar(value, plaintext)
+	}
+
+	delete(u.metadata.Secrets, path)
+	log.Printf("[DEBUG] Decrypted value of `%s`", key.Value)
+
+	return nil
+}
+
+// sealedWithPrefix returns the prefix of the value in case it is already sealed
+func (r *Resealer) sealedWithPrefix(value string) (string, bool) {
+	if strings.HasPrefix(value, r.oldPrefix) {
+		return r.oldPrefix, true
+	} else if strings.HasPrefix(value, r.prefix) {
+		return r.prefix, true
+	}
+
+	return "", false
+}
+
+// decryptValue decrypts a sealed value without prefix with the private keys of the controller
+func decryptValue(privateKeys map[string]*rsa.PrivateKey, label []byte, secret string) ([]byte, error) {
+	plaintext, _, err := decryptValueWithKey(privateKeys, label, secret)
+
+	return plaintext, err
+}
+
+// decryptValueWithKey decrypts a sealed value without prefix and returns the fingerprint of the key which decrypted it
+func decryptValueWithKey(privateKeys map[string]*rsa.PrivateKey, label []byte, secret string) ([]byte, string, error) {
+	decodedSecret, err := base64.StdEncoding.DecodeString(secret)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	for fingerprint, privateKey := range privateKeys {
+		key := map[string]*rsa.PrivateKey{fingerprint: privateKey}
+		if plaintext, err := crypto.HybridDecrypt(rand.Reader, key, decodedSecret, label); err == nil {
+			return plaintext, fingerprint, nil
+		}
+	}
+
+	return nil, "", errors.New("no key could decrypt secret")
+}
+
+// isUpToDate checks if the value of the path was sealed with the current cert and scope
+func (r *Resealer) isUpToDate(path string) bool {
+	secret, ok := r.metadata.Secrets[path]
+
+	return ok && secret.Cert == r.fingerprint && !r.scopeChanged
+}
+
+func (s *Sealer) Seal(path string, key *yaml.Node, value *yaml.Node) error {
+	if s.valueNeedsToBeSealed(path, key, value) {
+		plaintext, file, err := readPlaintext(value)
 
 		if err != nil {
 			return err
 		}
 
-		if value.Value == "" {
-			log.Printf("[WARNING] Value of `%s` is an empty string", key.Value)
-		} else if value.Value != strings.TrimSpace(value.Value) {
-			log.Printf("[WARNING] Value of `%s` is padded with whitespace", key.Value)
+		ciphertext, err := crypto.HybridEncrypt(rand.Reader, s.publicKey, plaintext, s.label)
+
+		if err != nil {
+			return err
+		}
+
+		warnAboutPlaintext(key, value, plaintext, file)
+		original := *value
+		setSealedValue(value, s.prefix, ciphertext)
+		s.metadata.updateSecret(path, s.fingerprint, s.metadata.getScope())
+		s.metadata.Secrets[path].File = file
+		s.metadata.Secrets[path].recordScalar(&original)
+
+		if file != "" {
+			s.files = append(s.files, file)
 		}
 
-		encodedSecret := base64.StdEncoding.EncodeToString(ciphertext)
-		value.SetString(fmt.Sprintf("%s%s", encodeIdentifier, encodedSecret))
-		s.metadata.SealedAt = time.Now().Format(time.RFC3339)
 		log.Printf("[DEBUG] Encrypted value of `%s`", key.Value)
 	}
 
 	return nil
 }
 
-func (s *Sealer) Verify(key *yaml.Node, value *yaml.Node) error {
-	if s.valueNeedsToBeSealed(key, value) {
+func (s *Sealer) Verify(path string, key *yaml.Node, value *yaml.Node) error {
+	if s.valueNeedsToBeSealed(path, key, value) {
 		return fmt.Errorf("key `%s` is not encrypted", key.Value)
 	}
 
+	if isSecret(s.secretsRegexp, s.metadata, path, key, value) {
+		publicKey := s.publicKey
+		if s.sealedWithKey != nil {
+			publicKey = s.sealedWithKey
+		}
+
+		if err := verifyCiphertext(publicKey, strings.TrimPrefix(value.Value, s.prefix)); err != nil {
+			return fmt.Errorf("key `%s` is not a valid ciphertext: %s", key.Value, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// verifyCiphertext checks if the secret matches the layout produced by `crypto.HybridEncrypt`:
+// RSA ciphertext length (2 bytes) || RSA ciphertext || AES-GCM ciphertext
+// Without a public key the length of the RSA ciphertext is not checked.
+func verifyCiphertext(publicKey *rsa.PublicKey, secret string) error {
+	ciphertext, err := base64.StdEncoding.DecodeString(secret)
+
+	if err != nil {
+		return errors.New("value is not base64 encoded")
+	}
+
+	if len(ciphertext) < 2 {
+		return errors.New("value is too short")
+	}
+
+	rsaLen := int(binary.BigEndian.Uint16(ciphertext))
+
+	if publicKey != nil && rsaLen != publicKey.Size() {
+		return fmt.Errorf("session key has a length of %d bytes, but the cert requires %d bytes", rsaLen, publicKey.Size())
+	}
+
+	if len(ciphertext) < 2+rsaLen+aesGcmTagSize {
+		return fmt.Errorf("value is truncated, %d bytes are missing", 2+rsaLen+aesGcmTagSize-len(ciphertext))
+	}
+
 	return nil
 }
 
@@ -234,6 +558,58 @@ func getPublicCert(d []byte) (*rsa.PublicKey, error) {
 	return publicCert, nil
 }
 
+func certFingerprint(d []byte) (string, error) {
+	publicCert, err := getPublicCert(d)
+
+	if err != nil {
+		return "", err
+	}
+
+	return crypto.PublicKeyFingerprint(publicCert)
+}
+
+// verifyEmbeddedCert checks if the cert of the metadata is still valid and
+// if it matches the current cert of the source of the sealing rule set
+func verifyEmbeddedCert(srs *SealingRuleSet, m *Metadata) error {
+	embeddedCert, err := getFirstCert([]byte(m.Cert))
+
+	if err != nil {
+		return fmt.Errorf("embedded cert can not be read: %s", err.Error())
+	}
+
+	var problems []string
+
+	if time.Now().After(embeddedCert.NotAfter) {
+		problems = append(problems, fmt.Sprintf("embedded cert expired at %s", embeddedCert.NotAfter))
+	}
+
+	if srs.Cert.MaxAge > 0 && time.Now().After(embeddedCert.NotBefore.Add(srs.Cert.MaxAge)) {
+		problems = append(problems, fmt.Sprintf("embedded cert is older than the maximum age of %s", srs.Cert.MaxAge))
+	}
+
+	embeddedFingerprint, err := certFingerprint([]byte(m.Cert))
+
+	if err != nil {
+		return fmt.Errorf("embedded cert can not be read: %s", err.Error())
+	}
+
+	currentCert, err := srs.GetCert()
+
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("current cert can not be fetched from source: %s", err.Error()))
+	} else if currentFingerprint, err := certFingerprint([]byte(currentCert)); err != nil {
+		problems = append(problems, fmt.Sprintf("current cert of source can not be read: %s", err.Error()))
+	} else if currentFingerprint != embeddedFingerprint {
+		problems = append(problems, fmt.Sprintf("embedded cert %s does not match the current cert %s of the source", embeddedFingerprint, currentFingerprint))
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
 func certStatus(d []byte, maxAge time.Duration) (int, error) {
 	cert, err := getFirstCert(d)
 
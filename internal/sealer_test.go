@@ -1,12 +1,21 @@
 package internal
 
 import (
+	cryptoRand "crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
 	"math/rand"
+	"os"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
 	"gopkg.in/yaml.v3"
 )
 
@@ -18,13 +27,14 @@ func TestSealSecrets(t *testing.T) {
 
 	s := Sealer{
 		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
 		publicKey:     &key.PublicKey,
 		metadata:      &Metadata{},
 	}
 
 	k := &yaml.Node{Value: "test_password"}
 	v := &yaml.Node{Value: "secret!"}
-	s.Seal(k, v)
+	s.Seal(k.Value, k, v)
 
 	if strings.Contains(v.Value, "secret!") && !strings.HasPrefix(v.Value, "ENC:") {
 		t.Errorf("Sealing was unsuccessful, got: %s, which contains: %s or no ENC indicator.", v.Value, "secret!")
@@ -36,31 +46,57 @@ func TestVerifySecrets(t *testing.T) {
 
 	s := Sealer{
 		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
 		publicKey:     &key.PublicKey,
 		metadata:      &Metadata{},
 	}
 
 	k := &yaml.Node{Value: "test_password"}
-	v := &yaml.Node{Value: "ENC:secret!"}
-	err := s.Verify(k, v)
+	v := &yaml.Node{Value: "secret!"}
+	s.Seal(k.Value, k, v)
+	err := s.Verify(k.Value, k, v)
 
 	if err != nil {
 		t.Errorf("Verify was unsuccessful, got an error %s.", err.Error())
 	}
 }
 
+func TestVerifyMalformedSecrets(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+
+	s := Sealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		metadata:      &Metadata{},
+	}
+
+	k := &yaml.Node{Value: "test_password"}
+	v := &yaml.Node{Value: "secret!"}
+	s.Seal(k.Value, k, v)
+
+	for _, malformed := range []string{"ENC:secret!", "ENC:", v.Value[:200]} {
+		err := s.Verify(k.Value, k, &yaml.Node{Value: malformed})
+
+		if err == nil {
+			t.Errorf("Verify was unsuccessful, got no error for malformed secret %s.", malformed)
+		}
+	}
+}
+
 func TestVerifyUnsealedSecrets(t *testing.T) {
 	key, _ := testGeneratePrivateKey()
 
 	s := Sealer{
 		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
 		publicKey:     &key.PublicKey,
 		metadata:      &Metadata{},
 	}
 
 	k := &yaml.Node{Value: "test_password"}
 	v := &yaml.Node{Value: "secret!"}
-	err := s.Verify(k, v)
+	err := s.Verify(k.Value, k, v)
 
 	if err == nil {
 		t.Errorf("Verify was unsuccessful, got no error due to unsealed secret.")
@@ -72,13 +108,14 @@ func TestSealingOfAlreadySealedSecrets(t *testing.T) {
 
 	s := Sealer{
 		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
 		publicKey:     &key.PublicKey,
 		metadata:      &Metadata{},
 	}
 
 	k := &yaml.Node{Value: "test_password"}
 	v := &yaml.Node{Value: "ENC:secret!"}
-	s.Seal(k, v)
+	s.Seal(k.Value, k, v)
 
 	if v.Value != "ENC:secret!" {
 		t.Errorf("Sealing sealed again, got: %s, want: %s.", v.Value, "ENC:secret!")
@@ -90,15 +127,526 @@ func TestSealNonSecrets(t *testing.T) {
 
 	s := Sealer{
 		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
 		publicKey:     &key.PublicKey,
 		metadata:      &Metadata{},
 	}
 
 	k := &yaml.Node{Value: "test"}
 	v := &yaml.Node{Value: "secret!"}
-	s.Seal(k, v)
+	s.Seal(k.Value, k, v)
 
 	if v.Value != "secret!" {
 		t.Errorf("Sealed yaml was incorrect, got: %s, want: %s.", v.Value, "secret!")
 	}
 }
+
+func testGenerateCert(key *rsa.PrivateKey, notBefore time.Time, notAfter time.Time) []byte {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+
+	der, _ := x509.CreateCertificate(rand.New(rand.NewSource(42)), template, template, &key.PublicKey, key)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func testPathRuleSet(cert []byte) (*SealingRuleSet, func()) {
+	f, _ := ioutil.TempFile("", "cert")
+	f.Write(cert)
+	f.Close()
+
+	return &SealingRuleSet{
+		Cert: &Cert{
+			MaxAge:  720 * time.Hour,
+			Sources: &Sources{Path: PathCertSource(f.Name())},
+		},
+	}, func() {
+		os.Remove(f.Name())
+	}
+}
+
+func TestVerifyEmbeddedCert(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	cert := testGenerateCert(key, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+
+	srs, cleanup := testPathRuleSet(cert)
+	defer cleanup()
+
+	if err := verifyEmbeddedCert(srs, &Metadata{Cert: string(cert)}); err != nil {
+		t.Errorf("Verify was unsuccessful, got an error %s.", err.Error())
+	}
+}
+
+func TestVerifyEmbeddedCertOfOtherSource(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	otherKey, _ := rsa.GenerateKey(rand.New(rand.NewSource(7)), 2048)
+	cert := testGenerateCert(key, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+
+	srs, cleanup := testPathRuleSet(testGenerateCert(otherKey, time.Now().Add(-time.Hour), time.Now().Add(time.Hour)))
+	defer cleanup()
+
+	if err := verifyEmbeddedCert(srs, &Metadata{Cert: string(cert)}); err == nil {
+		t.Error("Expected an error but got non")
+	}
+}
+
+func TestVerifyExpiredEmbeddedCert(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	cert := testGenerateCert(key, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+
+	srs, cleanup := testPathRuleSet(cert)
+	defer cleanup()
+
+	if err := verifyEmbeddedCert(srs, &Metadata{Cert: string(cert)}); err == nil {
+		t.Error("Expected an error but got non")
+	}
+}
+
+func TestResealWithNewScope(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	fp, _ := crypto.PublicKeyFingerprint(&key.PublicKey)
+	oldMetadata := &Metadata{Name: "old", Namespace: "default"}
+	newMetadata := Metadata{Name: "new", Namespace: "prod", Cert: "cert"}
+
+	s := Sealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		label:         oldMetadata.getLabel(),
+		metadata:      oldMetadata,
+	}
+
+	k := &yaml.Node{Value: "test_password"}
+	v := &yaml.Node{Value: "secret!"}
+	s.Seal(k.Value, k, v)
+
+	r := Resealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
+		oldPrefix:     encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		privateKeys:   map[string]*rsa.PrivateKey{fp: key},
+		label:         oldMetadata.getLabel(),
+		newLabel:      newMetadata.getLabel(),
+		newMetadata:   newMetadata,
+		metadata:      oldMetadata,
+	}
+
+	if err := r.Reseal(k.Value, k, v); err != nil {
+		t.Fatalf("Reseal was unsuccessful, got an error %s.", err.Error())
+	}
+
+	ciphertext, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(v.Value, encodeIdentifier))
+	plaintext, err := crypto.HybridDecrypt(cryptoRand.Reader, r.privateKeys, ciphertext, newMetadata.getLabel())
+
+	if err != nil || string(plaintext) != "secret!" {
+		t.Errorf("Resealed value was incorrect, got: %s, want: %s.", plaintext, "secret!")
+	}
+
+	if oldMetadata.Name == "new" || oldMetadata.Cert == "cert" {
+		t.Errorf("Metadata was updated by a single value, got: %v.", *oldMetadata)
+	}
+
+	r.UpdateMetadata()
+
+	if oldMetadata.Name != "new" || oldMetadata.Namespace != "prod" || oldMetadata.Cert != "cert" {
+		t.Errorf("Metadata was not updated, got: %v, want: %v.", *oldMetadata, newMetadata)
+	}
+}
+
+func TestResealWithHistoricalKey(t *testing.T) {
+	oldKey, _ := testGeneratePrivateKey()
+	newKey, _ := rsa.GenerateKey(rand.New(rand.NewSource(7)), 2048)
+	oldFp, _ := crypto.PublicKeyFingerprint(&oldKey.PublicKey)
+	newFp, _ := crypto.PublicKeyFingerprint(&newKey.PublicKey)
+	m := &Metadata{Name: "secret", Namespace: "default"}
+
+	s := Sealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
+		publicKey:     &oldKey.PublicKey,
+		label:         m.getLabel(),
+		metadata:      m,
+	}
+
+	k := &yaml.Node{Value: "test_password"}
+	v := &yaml.Node{Value: "secret!"}
+	s.Seal(k.Value, k, v)
+
+	r := Resealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
+		oldPrefix:     encodeIdentifier,
+		publicKey:     &newKey.PublicKey,
+		fingerprint:   newFp,
+		privateKeys:   map[string]*rsa.PrivateKey{oldFp: oldKey, newFp: newKey},
+		label:         m.getLabel(),
+		newLabel:      m.getLabel(),
+		newMetadata:   *m,
+		metadata:      m,
+	}
+
+	if err := r.Reseal(k.Value, k, v); err != nil {
+		t.Fatalf("Reseal was unsuccessful, got an error %s.", err.Error())
+	}
+
+	plaintext, fp, err := decryptValueWithKey(r.privateKeys, m.getLabel(), strings.TrimPrefix(v.Value, encodeIdentifier))
+
+	if err != nil || string(plaintext) != "secret!" || fp != newFp {
+		t.Errorf("Resealed value was incorrect, got: %s sealed with %s, want: %s sealed with %s.", plaintext, fp, "secret!", newFp)
+	}
+
+	if len(r.historicalKeys) != 1 || r.historicalKeys[0] != oldFp {
+		t.Errorf("Historical keys were incorrect, got: %v, want: %v.", r.historicalKeys, []string{oldFp})
+	}
+}
+
+func TestSealRecordsSecretMetadata(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	m := &Metadata{Name: "secret", Namespace: "default"}
+
+	s := Sealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		fingerprint:   "SHA256:current",
+		metadata:      m,
+	}
+
+	s.Seal("env.password", &yaml.Node{Value: "password"}, &yaml.Node{Value: "secret!"})
+
+	secret, ok := m.Secrets["env.password"]
+
+	if !ok {
+		t.Fatal("Metadata of the sealed path was not recorded.")
+	}
+
+	if secret.Cert != "SHA256:current" || secret.Scope != "strict" || secret.SealedAt != m.SealedAt {
+		t.Errorf("Metadata of the sealed path was incorrect, got: %v.", *secret)
+	}
+}
+
+func TestResealOutdatedOnly(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	fp, _ := crypto.PublicKeyFingerprint(&key.PublicKey)
+	m := &Metadata{
+		Secrets: map[string]*SecretMetadata{
+			"current_password": {Cert: fp},
+			"old_password":     {Cert: "SHA256:old"},
+		},
+	}
+
+	r := Resealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
+		oldPrefix:     encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		fingerprint:   fp,
+		privateKeys:   map[string]*rsa.PrivateKey{fp: key},
+		metadata:      m,
+		outdatedOnly:  true,
+	}
+
+	current := &yaml.Node{Value: "ENC:current"}
+	r.Reseal("current_password", &yaml.Node{Value: "current_password"}, current)
+
+	if current.Value != "ENC:current" {
+		t.Errorf("Value sealed with the current cert was resealed, got: %s, want: %s.", current.Value, "ENC:current")
+	}
+
+	old := &yaml.Node{Value: "ENC:old"}
+	if err := r.Reseal("old_password", &yaml.Node{Value: "old_password"}, old); err == nil {
+		t.Error("Value sealed with an outdated cert was not resealed.")
+	}
+}
+
+func TestResealOutdatedOnlyAfterScopeChange(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	fp, _ := crypto.PublicKeyFingerprint(&key.PublicKey)
+	m := &Metadata{Name: "old", Namespace: "default"}
+	newMetadata := Metadata{Name: "new", Namespace: "default"}
+
+	s := Sealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		fingerprint:   fp,
+		label:         m.getLabel(),
+		metadata:      m,
+	}
+
+	first := &yaml.Node{Value: "first"}
+	second := &yaml.Node{Value: "second"}
+	s.Seal("first_password", &yaml.Node{Value: "first_password"}, first)
+	s.Seal("second_password", &yaml.Node{Value: "second_password"}, second)
+
+	r := Resealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
+		oldPrefix:     encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		fingerprint:   fp,
+		privateKeys:   map[string]*rsa.PrivateKey{fp: key},
+		label:         m.getLabel(),
+		newLabel:      newMetadata.getLabel(),
+		newMetadata:   newMetadata,
+		metadata:      m,
+		outdatedOnly:  true,
+		scopeChanged:  true,
+	}
+
+	for path, value := range map[string]*yaml.Node{"first_password": first, "second_password": second} {
+		if err := r.Reseal(path, &yaml.Node{Value: path}, value); err != nil {
+			t.Fatalf("Reseal was unsuccessful, got an error %s.", err.Error())
+		}
+	}
+
+	for want, value := range map[string]*yaml.Node{"first": first, "second": second} {
+		plaintext, err := decryptValue(r.privateKeys, newMetadata.getLabel(), strings.TrimPrefix(value.Value, encodeIdentifier))
+
+		if err != nil || string(plaintext) != want {
+			t.Errorf("Value was not resealed with the new scope, got: %s, %v.", plaintext, err)
+		}
+	}
+}
+
+func TestResealWithNewPrefix(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	fp, _ := crypto.PublicKeyFingerprint(&key.PublicKey)
+
+	s := Sealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		metadata:      &Metadata{},
+	}
+
+	k := &yaml.Node{Value: "test_password"}
+	v := &yaml.Node{Value: "secret!"}
+	s.Seal(k.Value, k, v)
+
+	r := Resealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        "sealed:",
+		oldPrefix:     encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		fingerprint:   fp,
+		privateKeys:   map[string]*rsa.PrivateKey{fp: key},
+		metadata:      &Metadata{},
+		outdatedOnly:  true,
+	}
+
+	if err := r.Reseal(k.Value, k, v); err != nil {
+		t.Fatalf("Reseal was unsuccessful, got an error %s.", err.Error())
+	}
+
+	plaintext, err := decryptValue(r.privateKeys, nil, strings.TrimPrefix(v.Value, "sealed:"))
+
+	if !strings.HasPrefix(v.Value, "sealed:") || err != nil || string(plaintext) != "secret!" {
+		t.Errorf("Resealed value was incorrect, got: %s.", v.Value)
+	}
+}
+
+func TestSealFileReference(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	fp, _ := crypto.PublicKeyFingerprint(&key.PublicKey)
+	dir, _ := ioutil.TempDir("", "sealit")
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}()
+
+	file := "certs/tls.key"
+	content := []byte{0xff, 0x00, 0xfe, '\n'}
+	os.Mkdir("certs", 0755)
+	ioutil.WriteFile(file, content, 0600)
+
+	s := Sealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		fingerprint:   fp,
+		metadata:      &Metadata{},
+	}
+
+	k := &yaml.Node{Value: "tlsKey"}
+	v := &yaml.Node{Value: fileReferencePrefix + file}
+
+	if err := s.Verify(k.Value, k, v); err == nil {
+		t.Error("Verify was unsuccessful, got no error due to unsealed file reference.")
+	}
+
+	if err := s.Seal(k.Value, k, v); err != nil {
+		t.Fatalf("Sealing was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if s.metadata.Secrets["tlsKey"].File != file || len(s.files) != 1 {
+		t.Errorf("Referenced file was not recorded, got: %+v.", s.metadata.Secrets["tlsKey"])
+	}
+
+	if err := s.Verify(k.Value, k, v); err != nil {
+		t.Errorf("Verify was unsuccessful, got an error %s.", err.Error())
+	}
+
+	os.RemoveAll("certs")
+
+	u := Unsealer{
+		secretsRegexp: s.secretsRegexp,
+		prefix:        encodeIdentifier,
+		privateKeys:   map[string]*rsa.PrivateKey{fp: key},
+		metadata:      s.metadata,
+	}
+
+	if err := u.Unseal(k.Value, k, v); err != nil {
+		t.Fatalf("Unsealing was unsuccessful, got an error %s.", err.Error())
+	}
+
+	restored, _ := ioutil.ReadFile(file)
+
+	if v.Value != fileReferencePrefix+file || string(restored) != string(content) {
+		t.Errorf("Referenced file was not restored, got: %s with content %v.", v.Value, restored)
+	}
+}
+
+func TestFileReferenceOutsideOfWorkingDirectory(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	fp, _ := crypto.PublicKeyFingerprint(&key.PublicKey)
+
+	for _, file := range []string{"/etc/passwd", "../secret.key", "certs/../../secret.key"} {
+		if _, _, err := readPlaintext(&yaml.Node{Value: fileReferencePrefix + file}); err == nil || err.Error() != "referenced file "+file+" is outside of the working directory" {
+			t.Errorf("Error of %s was incorrect, got: %v.", file, err)
+		}
+
+		s := Sealer{
+			secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+			prefix:        encodeIdentifier,
+			publicKey:     &key.PublicKey,
+			fingerprint:   fp,
+			metadata:      &Metadata{},
+		}
+
+		k := &yaml.Node{Value: "tls_password"}
+		v := &yaml.Node{Value: "secret"}
+		s.Seal(k.Value, k, v)
+		s.metadata.Secrets[k.Value].File = file
+
+		u := Unsealer{
+			secretsRegexp: s.secretsRegexp,
+			prefix:        encodeIdentifier,
+			privateKeys:   map[string]*rsa.PrivateKey{fp: key},
+			metadata:      s.metadata,
+		}
+
+		if err := u.Unseal(k.Value, k, v); err == nil || err.Error() != "referenced file "+file+" is outside of the working directory" {
+			t.Errorf("Unsealing wrote to %s, got no error.", file)
+		}
+	}
+}
+
+func TestResealAndUnsealBinaryValue(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	fp, _ := crypto.PublicKeyFingerprint(&key.PublicKey)
+	content := []byte{0xff, 0x00, 0xfe}
+
+	s := Sealer{
+		secretsRegexp: regexp.MustCompile(`(password|pin)$`),
+		prefix:        encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		fingerprint:   fp,
+		metadata:      &Metadata{},
+	}
+
+	k := &yaml.Node{Value: "binary_pin"}
+	v := &yaml.Node{Tag: "!!binary", Value: base64.StdEncoding.EncodeToString(content)}
+	s.Seal(k.Value, k, v)
+
+	r := Resealer{
+		secretsRegexp: s.secretsRegexp,
+		prefix:        encodeIdentifier,
+		oldPrefix:     encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		fingerprint:   fp,
+		privateKeys:   map[string]*rsa.PrivateKey{fp: key},
+		metadata:      s.metadata,
+		newMetadata:   Metadata{},
+	}
+
+	if err := r.Reseal(k.Value, k, v); err != nil {
+		t.Fatalf("Reseal was unsuccessful, got an error %s.", err.Error())
+	}
+
+	u := Unsealer{
+		secretsRegexp: s.secretsRegexp,
+		prefix:        encodeIdentifier,
+		privateKeys:   r.privateKeys,
+		metadata:      s.metadata,
+	}
+
+	if err := u.Unseal(k.Value, k, v); err != nil {
+		t.Fatalf("Unsealing was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if v.Tag != "!!binary" || v.Value != base64.StdEncoding.EncodeToString(content) {
+		t.Errorf("Unsealed value was incorrect, got: %s %s.", v.Tag, v.Value)
+	}
+
+	if _, ok := s.metadata.Secrets["binary_pin"]; ok {
+		t.Error("Metadata of the unsealed value was kept.")
+	}
+}
+
+func TestUnsealRestoresScalars(t *testing.T) {
+	key, _ := testGeneratePrivateKey()
+	fp, _ := crypto.PublicKeyFingerprint(&key.PublicKey)
+	values := `pin: 1234
+enabled_pin: true
+cert_pin: |-
+    line one
+    line two
+key_pin: |
+    line one
+quoted_pin: 'single'
+`
+
+	var n yaml.Node
+	yaml.Unmarshal([]byte(values), &n)
+	mapping := n.Content[0]
+
+	s := Sealer{
+		secretsRegexp: regexp.MustCompile(`pin$`),
+		prefix:        encodeIdentifier,
+		publicKey:     &key.PublicKey,
+		fingerprint:   fp,
+		metadata:      &Metadata{},
+	}
+
+	u := Unsealer{
+		secretsRegexp: s.secretsRegexp,
+		prefix:        encodeIdentifier,
+		privateKeys:   map[string]*rsa.PrivateKey{fp: key},
+		metadata:      s.metadata,
+	}
+
+	for i := 0; i < len(mapping.Content); i = i + 2 {
+		s.Seal(mapping.Content[i].Value, mapping.Content[i], mapping.Content[i+1])
+	}
+
+	if sealed, _ := yaml.Marshal(&n); strings.Contains(string(sealed), "|") || s.metadata.Secrets["pin"].Tag != "!!int" || s.metadata.Secrets["cert_pin"].Style != "literal" {
+		t.Fatalf("Sealed values were incorrect, got: \n%s\nwith metadata %+v.", sealed, s.metadata.Secrets["pin"])
+	}
+
+	for i := 0; i < len(mapping.Content); i = i + 2 {
+		if err := u.Unseal(mapping.Content[i].Value, mapping.Content[i], mapping.Content[i+1]); err != nil {
+			t.Fatalf("Unsealing was unsuccessful, got an error %s.", err.Error())
+		}
+	}
+
+	if unsealed, _ := yaml.Marshal(&n); string(unsealed) != values {
+		t.Errorf("Unsealed values were incorrect, got: \n%s\n, want: \n%s\n.", unsealed, values)
+	}
+}
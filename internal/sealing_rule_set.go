@@ -7,18 +7,17 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"regexp"
 	"sort"
+	"strings"
 	"time"
 
 	ssv1alpha1 "github.com/bitnami-labs/sealed-secrets/pkg/apis/sealed-secrets/v1alpha1"
 	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/kubernetes"
 	certUtil "k8s.io/client-go/util/cert"
 	"k8s.io/client-go/util/keyutil"
 
@@ -26,18 +25,28 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 )
 
-var kubeConfig string
-
 type certSource interface {
 	fetch() (io.ReadCloser, error)
 }
 
 type SealingRuleSet struct {
-	FileRegex    string `yaml:"fileRegex"`
-	Name         string `yaml:"name"`
-	Namespace    string `yaml:"namespace"`
-	SecretsRegex string `yaml:"secretsRegex"`
-	Cert         *Cert  `yaml:"cert"`
+	FileRegex        string   `yaml:"fileRegex"`
+	Name             string   `yaml:"name"`
+	Namespace        string   `yaml:"namespace"`
+	SecretsRegex     string   `yaml:"secretsRegex"`
+	EncryptionPrefix string   `yaml:"encryptionPrefix,omitempty"`
+	MetadataKey      string   `yaml:"metadataKey,omitempty"`
+	Format           string   `yaml:"format,omitempty"`
+	NameField        string   `yaml:"nameField,omitempty"`
+	ValueField       string   `yaml:"valueField,omitempty"`
+	Cert             *Cert    `yaml:"cert"`
+	Targets          []Target `yaml:"targets,omitempty"`
+}
+
+// Target is a cluster, for which every secret is sealed with the cert of its controller
+type Target struct {
+	Name string `yaml:"name"`
+	Cert *Cert  `yaml:"cert"`
 }
 
 type Cert struct {
@@ -46,30 +55,103 @@ type Cert struct {
 }
 
 type Sources struct {
-	Url        UrlCertSource        `yaml:"url,omitempty"`
-	Path       PathCertSource       `yaml:"path,omitempty"`
-	Kubernetes KubernetesCertSource `yaml:"kubernetes,omitempty"`
+	Url        UrlCertSource         `yaml:"url,omitempty"`
+	Path       PathCertSource        `yaml:"path,omitempty"`
+	Kubernetes *KubernetesCertSource `yaml:"kubernetes,omitempty"`
+	Exec       *ExecCertSource       `yaml:"exec,omitempty"`
 }
 
-type UrlCertSource string
-
 type PathCertSource string
 
 type KubernetesCertSource struct {
-	Context   string `yaml:"context"`
-	Name      string `yaml:"name"`
-	Namespace string `yaml:"namespace"`
+	Context              string `yaml:"context"`
+	Name                 string `yaml:"name"`
+	Namespace            string `yaml:"namespace"`
+	Server               string `yaml:"server,omitempty"`
+	CertificateAuthority string `yaml:"certificateAuthority,omitempty"`
+	TokenFile            string `yaml:"tokenFile,omitempty"`
 }
 
 func (srs *SealingRuleSet) GetSecretsRegex() *regexp.Regexp {
 	return regexp.MustCompile(srs.SecretsRegex)
 }
 
+// GetEncryptionPrefix returns the prefix which marks encrypted values, `ENC:` by default
+func (srs *SealingRuleSet) GetEncryptionPrefix() string {
+	if srs.EncryptionPrefix == "" {
+		return encodeIdentifier
+	}
+
+	return srs.EncryptionPrefix
+}
+
+// GetMetadataKey returns the key of the metadata block within the values files, `sealit` by default
+func (srs *SealingRuleSet) GetMetadataKey() string {
+	if srs.MetadataKey == "" {
+		return sealitYamlKey
+	}
+
+	return srs.MetadataKey
+}
+
+// GetNameField returns the field whose value is matched instead of the key of its sibling value field, `name` by default
+func (srs *SealingRuleSet) GetNameField() string {
+	if srs.NameField == "" {
+		return defaultNameField
+	}
+
+	return srs.NameField
+}
+
+// GetValueField returns the field which is sealed when its sibling name field matches, `value` by default
+func (srs *SealingRuleSet) GetValueField() string {
+	if srs.ValueField == "" {
+		return defaultValueField
+	}
+
+	return srs.ValueField
+}
+
+// targetNames returns the names of the targets in the order of the config
+func (srs *SealingRuleSet) targetNames() []string {
+	names := make([]string, len(srs.Targets))
+	for i, t := range srs.Targets {
+		names[i] = t.Name
+	}
+
+	return names
+}
+
+// forTarget returns a copy of the rule set, which seals with the cert of the target
+func (srs *SealingRuleSet) forTarget(t Target) *SealingRuleSet {
+	tsrs := *srs
+	tsrs.Cert = t.Cert
+	tsrs.Targets = nil
+
+	return &tsrs
+}
+
+// getFormat returns the configured format or derives it from the file name
+func (srs *SealingRuleSet) getFormat(name string) string {
+	if srs.Format != "" {
+		return srs.Format
+	}
+
+	if name == ".env" || strings.HasPrefix(name, ".env.") || strings.HasSuffix(name, ".env") {
+		return dotenvFormat
+	} else if strings.HasSuffix(name, ".properties") {
+		return propertiesFormat
+	}
+
+	return yamlFormat
+}
+
 // GetCert fetches the cert from different sources
 // Prio:
 // 1. fetch from Kubernetes cluster
-// 2. fetch from url
-// 3. fetch from file path
+// 2. fetch from the output of a command
+// 3. fetch from url
+// 4. fetch from file path
 func (cs *SealingRuleSet) GetCert() (string, error) {
 	res, err := cs.Cert.getSource()
 	if err != nil {
@@ -87,17 +169,19 @@ func (cs *SealingRuleSet) GetCert() (string, error) {
 }
 
 func (c *Cert) getSource() (certSource, error) {
-	if c.Sources != nil {
-		if (c.Sources.Kubernetes != KubernetesCertSource{}) {
-			return c.Sources.Kubernetes, nil
-		} else if c.Sources.Url != "" {
+	if c != nil && c.Sources != nil {
+		if c.Sources.Kubernetes != nil {
+			return *c.Sources.Kubernetes, nil
+		} else if c.Sources.Exec != nil {
+			return *c.Sources.Exec, nil
+		} else if c.Sources.Url.Url != "" {
 			return c.Sources.Url, nil
 		} else if c.Sources.Path != "" {
 			return c.Sources.Path, nil
 		}
 	}
 
-	return nil, errors.New("no cert source like `kubernetes`, `url` or `path` was specified")
+	return nil, errors.New("no cert source like `kubernetes`, `exec`, `url` or `path` was specified")
 }
 
 func (path PathCertSource) fetch() (io.ReadCloser, error) {
@@ -105,46 +189,27 @@ func (path PathCertSource) fetch() (io.ReadCloser, error) {
 	return os.Open(string(path))
 }
 
-func (url UrlCertSource) fetch() (io.ReadCloser, error) {
-	log.Print("[DEBUG] Fetch cert from url")
-	resp, err := http.Get(string(url))
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("cannot fetch %q: %s", string(url), resp.Status)
-	}
-	return resp.Body, nil
-}
-
-func (kubernetes KubernetesCertSource) fetch() (io.ReadCloser, error) {
+func (k KubernetesCertSource) fetch() (io.ReadCloser, error) {
 	log.Print("[DEBUG] Fetch cert from within Kubernetes sealed secrets service")
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	loadingRules.DefaultClientConfig = &clientcmd.DefaultClientConfig
-	if kubeConfig != "" {
-		loadingRules.ExplicitPath = kubeConfig
-	}
-	overrides := clientcmd.ConfigOverrides{}
-
-	if kubernetes.Context != "" {
-		overrides.CurrentContext = kubernetes.Context
-	}
-
-	clientConfig := clientcmd.NewInteractiveDeferredLoadingClientConfig(loadingRules, &overrides, os.Stdin)
-	conf, err := clientConfig.ClientConfig()
+	conf, err := k.restConfig()
 
 	if err != nil {
 		return nil, err
 	}
 	conf.AcceptContentTypes = "application/x-pem-file, */*"
-	restClient, err := corev1.NewForConfig(conf)
+	client, err := kubernetes.NewForConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, name, err := k.controller(client)
 	if err != nil {
 		return nil, err
 	}
 
-	f, err := restClient.
-		Services(kubernetes.Namespace).
-		ProxyGet("http", kubernetes.Name, "", "/v1/cert.pem", nil).
+	f, err := client.CoreV1().
+		Services(namespace).
+		ProxyGet("http", name, "", "/v1/cert.pem", nil).
 		Stream()
 
 	if err != nil {
@@ -154,74 +219,76 @@ func (kubernetes KubernetesCertSource) fetch() (io.ReadCloser, error) {
 	return f, nil
 }
 
-func (k KubernetesCertSource) fetchKeys() (map[string]*rsa.PrivateKey, *rsa.PublicKey, error) {
-	log.Print("[DEBUG] Fetch cert from within Kubernetes sealed secrets service")
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	loadingRules.DefaultClientConfig = &clientcmd.DefaultClientConfig
-	if kubeConfig != "" {
-		loadingRules.ExplicitPath = kubeConfig
-	}
-	overrides := clientcmd.ConfigOverrides{}
-
-	if k.Context != "" {
-		overrides.CurrentContext = k.Context
+// fetchKeys returns all private keys of the controller by their fingerprint and the cert of the latest key,
+// as values sealed with an older key are still decrypted by the controller
+func (k KubernetesCertSource) fetchKeys() (map[string]*rsa.PrivateKey, string, error) {
+	log.Print("[DEBUG] Fetch keys from within Kubernetes sealed secrets service")
+	conf, err := k.restConfig()
+	if err != nil {
+		return nil, "", err
 	}
 
-	clientConfig := clientcmd.NewInteractiveDeferredLoadingClientConfig(loadingRules, &overrides, os.Stdin)
-	conf, err := clientConfig.ClientConfig()
+	client, err := kubernetes.NewForConfig(conf)
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 
-	restClient, err := corev1.NewForConfig(conf)
+	return k.keys(client)
+}
+
+func (k KubernetesCertSource) keys(client kubernetes.Interface) (map[string]*rsa.PrivateKey, string, error) {
+	namespace, _, err := k.controller(client)
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 
-	list, err := restClient.Secrets(k.Namespace).List(metav1.ListOptions{
+	list, err := client.CoreV1().Secrets(namespace).List(metav1.ListOptions{
 		LabelSelector: "sealedsecrets.bitnami.com/sealed-secrets-key",
 	})
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 
 	if len(list.Items) == 0 {
-		return nil, nil, fmt.Errorf("No certificates found")
+		return nil, "", fmt.Errorf("No certificates found")
 	}
 
 	sort.Sort(ssv1alpha1.ByCreationTimestamp(list.Items))
 
-	latestKey := &list.Items[len(list.Items)-1]
+	privKeys := map[string]*rsa.PrivateKey{}
 
-	privKey, err := keyutil.ParsePrivateKeyPEM(latestKey.Data[v1.TLSPrivateKeyKey])
-	if err != nil {
-		return nil, nil, err
-	}
+	for _, secret := range list.Items {
+		privKey, err := keyutil.ParsePrivateKeyPEM(secret.Data[v1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot parse key %s: %v", secret.Name, err)
+		}
 
-	certs, err := certUtil.ParseCertsPEM(latestKey.Data[v1.TLSCertKey])
-	if err != nil {
-		return nil, nil, err
-	}
+		rsaPrivKey, ok := privKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, "", fmt.Errorf("key %s is no RSA key", secret.Name)
+		}
 
-	if len(certs) == 0 {
-		return nil, nil, fmt.Errorf("Failed to read any certificates")
-	}
+		fp, err := crypto.PublicKeyFingerprint(&rsaPrivKey.PublicKey)
+		if err != nil {
+			return nil, "", err
+		}
 
-	rsaPrivKey := privKey.(*rsa.PrivateKey)
-	fp, err := crypto.PublicKeyFingerprint(&rsaPrivKey.PublicKey)
-	if err != nil {
-		return nil, nil, err
+		log.Printf("[DEBUG] Loaded key %s with fingerprint %s", secret.Name, fp)
+		privKeys[fp] = rsaPrivKey
 	}
 
-	privKeys := map[string]*rsa.PrivateKey{fp: rsaPrivKey}
+	latestKey := &list.Items[len(list.Items)-1]
 
-	cert, ok := certs[0].PublicKey.(*rsa.PublicKey)
+	certs, err := certUtil.ParseCertsPEM(latestKey.Data[v1.TLSCertKey])
+	if err != nil {
+		return nil, "", err
+	}
 
-	if !ok {
-		return nil, nil, fmt.Errorf("Expected RSA public key but found %v", certs[0].PublicKey)
+	if len(certs) == 0 {
+		return nil, "", fmt.Errorf("Failed to read any certificates")
 	}
 
-	return privKeys, cert, err
+	return privKeys, string(latestKey.Data[v1.TLSCertKey]), nil
 }
 
 func (s *SealingRuleSet) getLabel() []byte {
@@ -1,8 +1,18 @@
 package internal
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"math/rand"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestGetSource(t *testing.T) {
@@ -27,3 +37,92 @@ func TestNoSources(t *testing.T) {
 		t.Error("Expected an error but got non")
 	}
 }
+
+func TestDefaultPrefixAndMetadataKey(t *testing.T) {
+	srs := &SealingRuleSet{}
+
+	if srs.GetEncryptionPrefix() != "ENC:" || srs.GetMetadataKey() != "sealit" {
+		t.Errorf("Defaults were incorrect, got: %s and %s, want: %s and %s.", srs.GetEncryptionPrefix(), srs.GetMetadataKey(), "ENC:", "sealit")
+	}
+}
+
+func TestConfiguredPrefixAndMetadataKey(t *testing.T) {
+	srs := &SealingRuleSet{EncryptionPrefix: "sealed:", MetadataKey: "sealing-info"}
+
+	if srs.GetEncryptionPrefix() != "sealed:" || srs.GetMetadataKey() != "sealing-info" {
+		t.Errorf("Configured values were incorrect, got: %s and %s, want: %s and %s.", srs.GetEncryptionPrefix(), srs.GetMetadataKey(), "sealed:", "sealing-info")
+	}
+}
+
+func TestDefaultNameAndValueField(t *testing.T) {
+	srs := &SealingRuleSet{}
+
+	if srs.GetNameField() != "name" || srs.GetValueField() != "value" {
+		t.Errorf("Defaults were incorrect, got: %s and %s, want: %s and %s.", srs.GetNameField(), srs.GetValueField(), "name", "value")
+	}
+}
+
+func TestGetFormat(t *testing.T) {
+	srs := &SealingRuleSet{}
+	formats := map[string]string{
+		".env":             dotenvFormat,
+		".env.production":  dotenvFormat,
+		"staging.env":      dotenvFormat,
+		"app.properties":   propertiesFormat,
+		"values.yaml":      yamlFormat,
+		"values.dev.yaml":  yamlFormat,
+		"environment.yaml": yamlFormat,
+	}
+
+	for name, format := range formats {
+		if srs.getFormat(name) != format {
+			t.Errorf("Format of %s was incorrect, got: %s, want: %s.", name, srs.getFormat(name), format)
+		}
+	}
+
+	srs.Format = propertiesFormat
+	if srs.getFormat(".env") != propertiesFormat {
+		t.Errorf("Configured format was ignored, got: %s, want: %s.", srs.getFormat(".env"), propertiesFormat)
+	}
+}
+
+func testKeySecret(name string, created time.Time, key *rsa.PrivateKey) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "kube-system",
+			Labels:            map[string]string{"sealedsecrets.bitnami.com/sealed-secrets-key": "active"},
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Data: map[string][]byte{
+			v1.TLSPrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+			v1.TLSCertKey:       testGenerateCert(key, created, created.Add(time.Hour)),
+		},
+	}
+}
+
+func TestFetchAllKeys(t *testing.T) {
+	oldKey, _ := testGeneratePrivateKey()
+	newKey, _ := rsa.GenerateKey(rand.New(rand.NewSource(7)), 2048)
+	oldFp, _ := crypto.PublicKeyFingerprint(&oldKey.PublicKey)
+	newFp, _ := crypto.PublicKeyFingerprint(&newKey.PublicKey)
+	now := time.Now()
+
+	client := fake.NewSimpleClientset(
+		testKeySecret("sealed-secrets-key2", now, newKey),
+		testKeySecret("sealed-secrets-key1", now.Add(-time.Hour), oldKey),
+	)
+
+	keys, cert, err := KubernetesCertSource{Name: "sealed-secrets-controller", Namespace: "kube-system"}.keys(client)
+	if err != nil {
+		t.Fatalf("Fetching keys was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if len(keys) != 2 || keys[oldFp] == nil || keys[newFp] == nil {
+		t.Errorf("Keys were incorrect, got: %v.", keys)
+	}
+
+	if cert != string(testGenerateCert(newKey, now, now.Add(time.Hour))) {
+		t.Errorf("Cert was not the one of the latest key, got: %s.", cert)
+	}
+}
@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"crypto/rsa"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -10,35 +12,10 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// Source for this template is https://github.com/bitnami-labs/sealed-secrets#sealedsecrets-as-templates-for-secrets
-var template = []byte(`apiVersion: bitnami.com/v1alpha1
-kind: SealedSecret
-metadata:
-  {{- if (ne "" .Values.sealit.name) }}
-  name: {{ .Values.sealit.name }}
-  {{- end }}
-  {{- if (ne "" .Values.sealit.namespace) }}
-  name: {{ .Values.sealit.namespace }}
-  {{- end }}
-  labels:
-    {{- include "sample-chart.labels" . | nindent 4 }}
-{{- if and (ne "" .Values.sealit.namespace) (ne "" .Values.sealit.name) }}
-  annotations:
-  {{- if (eq "" .Values.sealit.namespace) }}
-    "sealedsecrets.bitnami.com/cluster-wide": "true"
-  {{- else if (eq "" .Values.sealit.name) }}
-    "sealedsecrets.bitnami.com/namespace-wide": "true"
-  {{- end }}
-{{- end }}
-spec:
-  encryptedData:
-    # Here you list your env variables. Do not forget to trim the prefixed "ENC:"!
-    #PASSWORD: {{ .Values.env.password | trimPrefix "ENC:" }}
-`)
-
 type Sealit struct {
-	config    *Config
-	fetchCert bool
+	config       *Config
+	fetchCert    bool
+	changedSince string
 }
 
 func Init(sealitconfig string, force bool) (err error) {
@@ -60,15 +37,6 @@ func Init(sealitconfig string, force bool) (err error) {
 	return nil
 }
 
-func Template(sealedSecretPath string) (err error) {
-	if sealedSecretPath == "" {
-		fmt.Printf("%s", template)
-		return nil
-	}
-
-	return ioutil.WriteFile(sealedSecretPath, template, 0644)
-}
-
 func New(sealitconfig string, kubeconfig string, fetchCert bool) (*Sealit, error) {
 	kubeConfig = kubeconfig
 	log.Printf("[DEBUG] Load config file %s", sealitconfig)
@@ -90,32 +58,119 @@ func New(sealitconfig string, kubeconfig string, fetchCert bool) (*Sealit, error
 	}, nil
 }
 
-func (s *Sealit) Reseal() (err error) {
+// OnlyFilesChangedSince limits the processed files to files which were added or modified since the git revision
+func (s *Sealit) OnlyFilesChangedSince(revision string) {
+	s.changedSince = revision
+}
+
+// Reseal decrypts and encrypts all secrets with the newest cert. The prefix and metadata key
+// of files sealed with a different configuration can be provided to migrate them.
+func (s *Sealit) Reseal(outdatedOnly bool, fromPrefix string, fromMetadataKey string) (err error) {
 	return s.applyToEveryMatchingFile(func(srs *SealingRuleSet, f os.FileInfo) (err error) {
 		data, err := ioutil.ReadFile(f.Name())
 		if err != nil {
 			return err
 		}
 
+		if isManifest(data) {
+			log.Printf("[DEBUG] Skip file %s as SealedSecret manifests can not be resealed", f.Name())
+			return nil
+		}
+
+		metadataKey := srs.GetMetadataKey()
+		if fromMetadataKey != "" {
+			metadataKey = fromMetadataKey
+		}
+
 		log.Printf("[DEBUG] Load values file %s", f.Name())
-		vf, err := NewValueFile(data)
+		vf, err := loadValuesFile(srs, f.Name(), data, metadataKey)
 		if err != nil {
 			return err
 		}
 
-		log.Print("[DEBUG] Load sealer based on config and values file")
-		resealer, err := NewResealer(srs, vf.Metadata)
+		vf.MoveMetadata(srs.GetMetadataKey())
+
+		historicalKeys, err := resealValuesFile(srs, vf, outdatedOnly, fromPrefix)
+		if err != nil {
+			return fmt.Errorf("in file %s %s", f.Name(), err.Error())
+		}
+
+		reportHistoricalKeys(f.Name(), historicalKeys)
+
+		log.Print("[DEBUG] Export resealed yaml.Node tree")
+		data, err = vf.Export()
 		if err != nil {
 			return err
 		}
 
-		log.Print("[DEBUG] Apply resealing function")
-		err = vf.ApplyFuncToValues(resealer.Reseal)
+		return ioutil.WriteFile(f.Name(), data, 0644)
+	})
+}
+
+// resealValuesFile reseals the values of the file for the cert of the rule set or for all its targets
+// and returns the fingerprints of historical controller keys, with which values were sealed
+func resealValuesFile(srs *SealingRuleSet, vf valuesFile, outdatedOnly bool, oldPrefix string) ([]string, error) {
+	if len(srs.Targets) > 0 {
+		return resealTargets(srs, vf, outdatedOnly, oldPrefix)
+	}
+
+	log.Print("[DEBUG] Load sealer based on config and values file")
+	resealer, err := NewResealer(srs, vf.getMetadata(), outdatedOnly, oldPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Print("[DEBUG] Apply resealing function")
+	if err := vf.ApplyFuncToValues(resealer.Reseal); err != nil {
+		return nil, err
+	}
+
+	resealer.UpdateMetadata()
+
+	return resealer.historicalKeys, nil
+}
+
+// reportHistoricalKeys logs the historical controller keys, with which values of the file were sealed
+func reportHistoricalKeys(file string, fingerprints []string) {
+	for _, fingerprint := range fingerprints {
+		log.Printf("[WARNING] File %s was sealed with the historical key %s", file, fingerprint)
+	}
+}
+
+// Rescope re-encrypts the secrets of all files whose scope differs from the
+// name and namespace of the sealing rule set
+func (s *Sealit) Rescope() (err error) {
+	return s.applyToEveryMatchingFile(func(srs *SealingRuleSet, f os.FileInfo) (err error) {
+		data, err := ioutil.ReadFile(f.Name())
 		if err != nil {
 			return err
 		}
 
-		log.Print("[DEBUG] Export resealed yaml.Node tree")
+		if isManifest(data) {
+			log.Printf("[DEBUG] Skip file %s as SealedSecret manifests can not be rescoped", f.Name())
+			return nil
+		}
+
+		log.Printf("[DEBUG] Load values file %s", f.Name())
+		vf, err := loadValuesFile(srs, f.Name(), data, srs.GetMetadataKey())
+		if err != nil {
+			return err
+		}
+
+		if vf.getMetadata().isEmpty() || (vf.getMetadata().Name == srs.Name && vf.getMetadata().Namespace == srs.Namespace) {
+			log.Printf("[DEBUG] Skip file %s as its scope matches the sealing rules", f.Name())
+			return nil
+		}
+
+		log.Printf("[DEBUG] Rescope file %s from `%s/%s` to `%s/%s`", f.Name(), vf.getMetadata().Namespace, vf.getMetadata().Name, srs.Namespace, srs.Name)
+		historicalKeys, err := resealValuesFile(srs, vf, false, "")
+		if err != nil {
+			return fmt.Errorf("in file %s %s", f.Name(), err.Error())
+		}
+
+		reportHistoricalKeys(f.Name(), historicalKeys)
+
+		log.Print("[DEBUG] Export rescoped yaml.Node tree")
 		data, err = vf.Export()
 		if err != nil {
 			return err
@@ -125,32 +180,118 @@ func (s *Sealit) Reseal() (err error) {
 	})
 }
 
-func (s *Sealit) Seal(force bool) (err error) {
+// Seal encrypts all secrets. The files referenced by values can be removed or added to the .gitignore after sealing.
+func (s *Sealit) Seal(force bool, removeSources bool, gitignoreSources bool) (err error) {
 	return s.applyToEveryMatchingFile(func(srs *SealingRuleSet, f os.FileInfo) (err error) {
 		data, err := ioutil.ReadFile(f.Name())
 		if err != nil {
 			return err
 		}
 
+		if isManifest(data) {
+			log.Printf("[DEBUG] Seal Secret manifests of file %s", f.Name())
+			if data, err = sealManifestFile(srs, data); err != nil {
+				return fmt.Errorf("in file %s %s", f.Name(), err.Error())
+			}
+
+			return ioutil.WriteFile(f.Name(), data, 0644)
+		}
+
 		log.Printf("[DEBUG] Load values file %s", f.Name())
-		vf, err := NewValueFile(data)
+		vf, err := loadValuesFile(srs, f.Name(), data, srs.GetMetadataKey())
 		if err != nil {
 			return err
 		}
 
-		log.Print("[DEBUG] Load sealer based on config and values file")
-		sealer, err := NewSealer(srs, vf.Metadata, s.fetchCert)
+		var files []string
+
+		if len(srs.Targets) > 0 {
+			if files, err = sealTargets(srs, vf, s.fetchCert); err != nil {
+				return fmt.Errorf("in file %s %s", f.Name(), err.Error())
+			}
+		} else {
+			log.Print("[DEBUG] Load sealer based on config and values file")
+			sealer, err := NewSealer(srs, vf.getMetadata(), s.fetchCert)
+			if err != nil {
+				return err
+			}
+
+			log.Print("[DEBUG] Apply sealing function")
+			err = vf.ApplyFuncToValues(sealer.Seal)
+			if err != nil {
+				return err
+			}
+
+			files = sealer.files
+		}
+
+		log.Print("[DEBUG] Export sealed yaml.Node tree")
+		data, err = vf.Export()
 		if err != nil {
 			return err
 		}
 
-		log.Print("[DEBUG] Apply sealing function")
-		err = vf.ApplyFuncToValues(sealer.Seal)
+		if err := ioutil.WriteFile(f.Name(), data, 0644); err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			if gitignoreSources {
+				if err := gitignore(file); err != nil {
+					return err
+				}
+			}
+
+			if removeSources {
+				log.Printf("[DEBUG] Remove sealed file %s", file)
+				if err := os.Remove(file); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Unseal decrypts all secrets with the private keys of the controller and
+// restores the content of referenced files
+func (s *Sealit) Unseal() (err error) {
+	return s.applyToEveryMatchingFile(func(srs *SealingRuleSet, f os.FileInfo) (err error) {
+		data, err := ioutil.ReadFile(f.Name())
 		if err != nil {
 			return err
 		}
 
-		log.Print("[DEBUG] Export sealed yaml.Node tree")
+		if isManifest(data) {
+			log.Printf("[DEBUG] Skip file %s as SealedSecret manifests can not be unsealed", f.Name())
+			return nil
+		}
+
+		log.Printf("[DEBUG] Load values file %s", f.Name())
+		vf, err := loadValuesFile(srs, f.Name(), data, srs.GetMetadataKey())
+		if err != nil {
+			return err
+		}
+
+		if len(srs.Targets) > 0 {
+			err = unsealTargets(srs, vf)
+		} else {
+			log.Print("[DEBUG] Load unsealer based on config and values file")
+			unsealer, err := NewUnsealer(srs, vf.getMetadata())
+			if err != nil {
+				return err
+			}
+
+			log.Print("[DEBUG] Apply unsealing function")
+			err = vf.ApplyFuncToValues(unsealer.Unseal)
+		}
+
+		if err != nil {
+			return fmt.Errorf("in file %s %s", f.Name(), err.Error())
+		}
+
+		log.Print("[DEBUG] Export unsealed yaml.Node tree")
 		data, err = vf.Export()
 		if err != nil {
 			return err
@@ -160,21 +301,89 @@ func (s *Sealit) Seal(force bool) (err error) {
 	})
 }
 
-func (s *Sealit) Verify() (err error) {
-	return s.applyToEveryMatchingFile(func(srs *SealingRuleSet, fi os.FileInfo) (err error) {
-		data, err := ioutil.ReadFile(fi.Name())
+// sealManifestFile converts the Secret manifests of a file into SealedSecret manifests,
+// as there is no metadata block the cert is always fetched from the source
+func sealManifestFile(srs *SealingRuleSet, data []byte) ([]byte, error) {
+	if len(srs.Targets) > 0 {
+		return nil, errors.New("targets are not supported for Secret manifests")
+	}
+
+	cert, err := srs.GetCert()
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := getPublicCert([]byte(cert))
+	if err != nil {
+		return nil, err
+	}
+
+	return sealManifests(srs, data, publicKey)
+}
+
+// manifestPublicKey returns the key of the cert source for verifying SealedSecret manifests,
+// as they have no metadata block. Without a cert only the layout of the encrypted data is verified.
+func manifestPublicKey(srs *SealingRuleSet) *rsa.PublicKey {
+	cert, err := srs.GetCert()
+	if err == nil {
+		var publicKey *rsa.PublicKey
+		if publicKey, err = getPublicCert([]byte(cert)); err == nil {
+			return publicKey
+		}
+	}
+
+	log.Printf("[WARNING] Cannot get the cert for verifying SealedSecrets, the length of the session keys is not checked: %v", err)
+
+	return nil
+}
+
+func (s *Sealit) Verify(staged bool, strict bool) (err error) {
+	verify := func(srs *SealingRuleSet, file string) (err error) {
+		var data []byte
+
+		if staged {
+			log.Printf("[DEBUG] Read staged content of file %s", file)
+			data, err = gitReadStagedFile(file)
+		} else {
+			data, err = ioutil.ReadFile(file)
+		}
+
 		if err != nil {
 			return err
 		}
 
-		log.Printf("[DEBUG] Load values file %s", fi.Name())
-		vf, err := NewValueFile(data)
+		if isManifest(data) {
+			log.Printf("[DEBUG] Verify Secret manifests of file %s", file)
+			if err := verifyManifests(data, manifestPublicKey(srs)); err != nil {
+				return fmt.Errorf("in file %s %s", file, err.Error())
+			}
+
+			return nil
+		}
+
+		log.Printf("[DEBUG] Load values file %s", file)
+		vf, err := loadValuesFile(srs, file, data, srs.GetMetadataKey())
 		if err != nil {
 			return err
 		}
 
+		if len(srs.Targets) > 0 {
+			if err := verifyTargets(srs, vf, s.fetchCert, strict); err != nil {
+				return fmt.Errorf("in file %s %s", file, err.Error())
+			}
+
+			return nil
+		}
+
+		if strict && !vf.getMetadata().isEmpty() {
+			log.Print("[DEBUG] Verify embedded cert against the cert source")
+			if err := verifyEmbeddedCert(srs, vf.getMetadata()); err != nil {
+				return fmt.Errorf("in file %s %s", file, err.Error())
+			}
+		}
+
 		log.Print("[DEBUG] Load sealer based on config and values file")
-		sealer, err := NewSealer(srs, vf.Metadata, s.fetchCert)
+		sealer, err := NewSealer(srs, vf.getMetadata(), s.fetchCert)
 		if err != nil {
 			return err
 		}
@@ -183,10 +392,18 @@ func (s *Sealit) Verify() (err error) {
 		err = vf.ApplyFuncToValues(sealer.Verify)
 
 		if err != nil {
-			return fmt.Errorf("in file %s %s", fi.Name(), err.Error())
+			return fmt.Errorf("in file %s %s", file, err.Error())
 		}
 
 		return err
+	}
+
+	if staged {
+		return s.applyToEveryMatchingStagedFile(verify)
+	}
+
+	return s.applyToEveryMatchingFile(func(srs *SealingRuleSet, fi os.FileInfo) error {
+		return verify(srs, fi.Name())
 	})
 }
 
@@ -197,15 +414,71 @@ func (s *Sealit) applyToEveryMatchingFile(fun func(*SealingRuleSet, os.FileInfo)
 		return err
 	}
 
+	changedFiles, err := s.changedFiles()
+	if err != nil {
+		return err
+	}
+
 	for _, f := range files {
+		if changedFiles != nil && !changedFiles[f.Name()] {
+			log.Printf("[DEBUG] Skip file %s as it was not changed since %s", f.Name(), s.changedSince)
+			continue
+		}
+
 		if !f.IsDir() {
-			for _, srs := range s.config.SealingRuleSets {
-				fileNamePattern := regexp.MustCompile(srs.FileRegex)
-				if fileNamePattern.MatchString(f.Name()) {
-					if err := fun(&srs, f); err != nil {
-						return err
-					}
-				}
+			if err := s.applyToMatchingRuleSets(f.Name(), func(srs *SealingRuleSet) error { return fun(srs, f) }); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyToEveryMatchingStagedFile applies the function to the files of the current directory in the git index,
+// so staged files are found even if they were removed from or never written to the working tree
+func (s *Sealit) applyToEveryMatchingStagedFile(fun func(*SealingRuleSet, string) error) error {
+	files, err := gitStagedFiles()
+	if err != nil {
+		return err
+	}
+
+	changedFiles, err := s.changedFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if changedFiles != nil && !changedFiles[file] {
+			log.Printf("[DEBUG] Skip file %s as it was not changed since %s", file, s.changedSince)
+			continue
+		}
+
+		if err := s.applyToMatchingRuleSets(file, func(srs *SealingRuleSet) error { return fun(srs, file) }); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// changedFiles returns the files changed since the revision of `--changed-since` or nil, if it is not set
+func (s *Sealit) changedFiles() (map[string]bool, error) {
+	if s.changedSince == "" {
+		return nil, nil
+	}
+
+	log.Printf("[DEBUG] Limit files to files changed since %s", s.changedSince)
+	return gitChangedFiles(s.changedSince)
+}
+
+// applyToMatchingRuleSets applies the function to every sealing rule set whose file regex matches the file
+func (s *Sealit) applyToMatchingRuleSets(file string, fun func(*SealingRuleSet) error) error {
+	for _, srs := range s.config.SealingRuleSets {
+		fileNamePattern := regexp.MustCompile(srs.FileRegex)
+		if fileNamePattern.MatchString(file) {
+			if err := fun(&srs); err != nil {
+				return err
 			}
 		}
 	}
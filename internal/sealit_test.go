@@ -1,9 +1,26 @@
 package internal
 
 import (
+	"bytes"
+	"io/ioutil"
 	"testing"
 )
 
 func TestSeal(t *testing.T) {
 	//
 }
+
+func TestRescopeSkipsManifests(t *testing.T) {
+	defer testGitRepo(t)()
+
+	ioutil.WriteFile("secrets.dev.yaml", secretManifests, 0644)
+	s := &Sealit{config: &Config{SealingRuleSets: []SealingRuleSet{{FileRegex: `\.dev\.yaml$`, Name: "database", Namespace: "prod", Cert: &Cert{}}}}}
+
+	if err := s.Rescope(); err != nil {
+		t.Fatalf("Rescope was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if d, _ := ioutil.ReadFile("secrets.dev.yaml"); !bytes.Equal(d, secretManifests) {
+		t.Errorf("Manifest was changed, got: \n%s", d)
+	}
+}
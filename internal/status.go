@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type FileStatus struct {
+	File            string                     `json:"file"`
+	FileRegex       string                     `json:"fileRegex"`
+	Name            string                     `json:"name"`
+	Namespace       string                     `json:"namespace"`
+	Scope           string                     `json:"scope"`
+	SealedAt        string                     `json:"sealedAt"`
+	CertFingerprint string                     `json:"certFingerprint"`
+	CertNotBefore   string                     `json:"certNotBefore"`
+	CertNotAfter    string                     `json:"certNotAfter"`
+	CertStatus      string                     `json:"certStatus"`
+	SealedKeys      int                        `json:"sealedKeys"`
+	UnsealedKeys    int                        `json:"unsealedKeys"`
+	UnmatchedKeys   int                        `json:"unmatchedKeys"`
+	Secrets         map[string]*SecretMetadata `json:"secrets,omitempty"`
+}
+
+// Scopes of files without a metadata block
+const (
+	scopeUnsealed = "unsealed"
+	scopeUnknown  = "unknown"
+)
+
+type keyCounter struct {
+	secretsRegexp *regexp.Regexp
+	metadata      *Metadata
+	prefix        string
+	sealed        int
+	unsealed      int
+	unmatched     int
+}
+
+func (s *Sealit) Status(output string) (err error) {
+	status, err := s.fileStatus()
+	if err != nil {
+		return err
+	}
+
+	switch output {
+	case "json":
+		return printStatusJSON(os.Stdout, status)
+	case "table", "":
+		return printStatusTable(os.Stdout, status)
+	default:
+		return fmt.Errorf("unknown output format %s, use `table` or `json`", output)
+	}
+}
+
+// fileStatus returns the status of every matching values file, manifests are skipped
+func (s *Sealit) fileStatus() (status []FileStatus, err error) {
+	err = s.applyToEveryMatchingFile(func(srs *SealingRuleSet, fi os.FileInfo) (err error) {
+		data, err := ioutil.ReadFile(fi.Name())
+		if err != nil {
+			return err
+		}
+
+		if isManifest(data) {
+			log.Printf("[DEBUG] Skip file %s as SealedSecret manifests have no sealing metadata", fi.Name())
+			return nil
+		}
+
+		log.Printf("[DEBUG] Load values file %s", fi.Name())
+		vf, err := loadValuesFile(srs, fi.Name(), data, srs.GetMetadataKey())
+		if err != nil {
+			return err
+		}
+
+		fs, err := newFileStatus(fi.Name(), srs, vf)
+		if err != nil {
+			return fmt.Errorf("in file %s %s", fi.Name(), err.Error())
+		}
+
+		status = append(status, fs)
+
+		return nil
+	})
+
+	return status, err
+}
+
+func newFileStatus(name string, srs *SealingRuleSet, vf valuesFile) (fs FileStatus, err error) {
+	m := vf.getMetadata()
+	scope := m.getScope()
+
+	fs = FileStatus{
+		File:      name,
+		FileRegex: srs.FileRegex,
+		Name:      m.Name,
+		Namespace: m.Namespace,
+		Scope:     scope.String(),
+		SealedAt:  m.SealedAt,
+		Secrets:   m.Secrets,
+	}
+
+	if m.Cert != "" {
+		cert, err := getFirstCert([]byte(m.Cert))
+		if err != nil {
+			return fs, err
+		}
+
+		if fs.CertFingerprint, err = certFingerprint([]byte(m.Cert)); err != nil {
+			return fs, err
+		}
+
+		status, err := certStatus([]byte(m.Cert), srs.Cert.MaxAge)
+		if err != nil {
+			return fs, err
+		}
+
+		fs.CertNotBefore = cert.NotBefore.Format(time.RFC3339)
+		fs.CertNotAfter = cert.NotAfter.Format(time.RFC3339)
+		fs.CertStatus = certStatusName(status)
+	}
+
+	counter := &keyCounter{
+		secretsRegexp: srs.GetSecretsRegex(),
+		metadata:      m,
+		prefix:        srs.GetEncryptionPrefix(),
+	}
+	if err := vf.ApplyFuncToValues(counter.count); err != nil {
+		return fs, err
+	}
+
+	fs.SealedKeys = counter.sealed
+	fs.UnsealedKeys = counter.unsealed
+	fs.UnmatchedKeys = counter.unmatched
+
+	// Without metadata the scope cannot be derived, an empty block would read as cluster-wide
+	if m.isEmpty() {
+		if counter.sealed > 0 {
+			fs.Scope = scopeUnknown
+		} else {
+			fs.Scope = scopeUnsealed
+		}
+	}
+
+	return fs, nil
+}
+
+func (c *keyCounter) count(path string, key *yaml.Node, value *yaml.Node) error {
+	if !isSecretOfFile(c.secretsRegexp, c.metadata, path, key, value) {
+		c.unmatched++
+	} else if strings.HasPrefix(value.Value, c.prefix) {
+		c.sealed++
+	} else {
+		c.unsealed++
+	}
+
+	return nil
+}
+
+func certStatusName(status int) string {
+	switch status {
+	case validCert:
+		return "valid"
+	case deprecatedCert:
+		return "deprecated"
+	default:
+		return "invalid"
+	}
+}
+
+func printStatusJSON(w io.Writer, status []FileStatus) error {
+	if status == nil {
+		status = []FileStatus{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(status)
+}
+
+func printStatusTable(w io.Writer, status []FileStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "FILE\tRULE\tNAME\tNAMESPACE\tSCOPE\tSEALED AT\tCERT\tNOT BEFORE\tNOT AFTER\tCERT STATUS\tSEALED\tUNSEALED\tUNMATCHED")
+	for _, fs := range status {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\n",
+			fs.File,
+			fs.FileRegex,
+			orDash(fs.Name),
+			orDash(fs.Namespace),
+			fs.Scope,
+			orDash(fs.SealedAt),
+			orDash(fs.CertFingerprint),
+			orDash(fs.CertNotBefore),
+			orDash(fs.CertNotAfter),
+			orDash(fs.CertStatus),
+			fs.SealedKeys,
+			fs.UnsealedKeys,
+			fs.UnmatchedKeys,
+		)
+	}
+
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
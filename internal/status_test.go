@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileStatus(t *testing.T) {
+	f, _ := NewValueFile(transformedDataWithSealit)
+	srs := &SealingRuleSet{
+		FileRegex:    "\\.dev\\.yaml$",
+		SecretsRegex: "(password|pin)$",
+		Cert:         &Cert{MaxAge: 720 * time.Hour},
+	}
+
+	fs, err := newFileStatus("values.dev.yaml", srs, f)
+
+	if err != nil {
+		t.Fatalf("Status was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if fs.Scope != "strict" {
+		t.Errorf("Scope was incorrect, got: %s, want: %s.", fs.Scope, "strict")
+	}
+
+	if !strings.HasPrefix(fs.CertFingerprint, "SHA256:") {
+		t.Errorf("Cert fingerprint was incorrect, got: %s.", fs.CertFingerprint)
+	}
+
+	if fs.SealedKeys != 1 || fs.UnsealedKeys != 0 || fs.UnmatchedKeys != 1 {
+		t.Errorf("Key counts were incorrect, got: %d/%d/%d, want: %d/%d/%d.", fs.SealedKeys, fs.UnsealedKeys, fs.UnmatchedKeys, 1, 0, 1)
+	}
+}
+
+func TestFileStatusWithoutMetadata(t *testing.T) {
+	f, _ := NewValueFile(untransformedDataImport)
+	srs := &SealingRuleSet{
+		SecretsRegex: "(password|pin)$",
+		Cert:         &Cert{},
+	}
+
+	fs, err := newFileStatus("values.dev.yaml", srs, f)
+
+	if err != nil {
+		t.Fatalf("Status was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if fs.Scope != "unsealed" || fs.CertStatus != "" {
+		t.Errorf("Status was incorrect, got scope: %s and cert status: %s.", fs.Scope, fs.CertStatus)
+	}
+
+	if fs.UnsealedKeys != 5 {
+		t.Errorf("Unsealed keys were incorrect, got: %d, want: %d.", fs.UnsealedKeys, 5)
+	}
+}
+
+func TestFileStatusOfSealedValuesWithoutMetadata(t *testing.T) {
+	f, _ := NewValueFile([]byte("password: ENC:secret\n"))
+	srs := &SealingRuleSet{
+		SecretsRegex: "(password|pin)$",
+		Cert:         &Cert{},
+	}
+
+	fs, err := newFileStatus("values.dev.yaml", srs, f)
+
+	if err != nil {
+		t.Fatalf("Status was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if fs.Scope != "unknown" || fs.SealedKeys != 1 {
+		t.Errorf("Status was incorrect, got scope: %s and sealed keys: %d.", fs.Scope, fs.SealedKeys)
+	}
+}
+
+func TestFileStatusOfFileReference(t *testing.T) {
+	f, _ := NewValueFile([]byte(`tlsKey: ENC:abc
+replicas: 2
+sealit:
+    name: secret
+    namespace: default
+    secrets:
+        tlsKey:
+            file: tls.key
+`))
+	srs := &SealingRuleSet{
+		SecretsRegex: "(password|pin)$",
+		Cert:         &Cert{},
+	}
+
+	fs, err := newFileStatus("values.dev.yaml", srs, f)
+
+	if err != nil {
+		t.Fatalf("Status was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if fs.SealedKeys != 1 || fs.UnsealedKeys != 0 || fs.UnmatchedKeys != 1 {
+		t.Errorf("Key counts were incorrect, got: %d/%d/%d, want: %d/%d/%d.", fs.SealedKeys, fs.UnsealedKeys, fs.UnmatchedKeys, 1, 0, 1)
+	}
+}
+
+func TestPrintStatusJSON(t *testing.T) {
+	var b bytes.Buffer
+
+	printStatusJSON(&b, nil)
+
+	if b.String() != "[]\n" {
+		t.Errorf("JSON output was incorrect, got: %s, want: %s.", b.String(), "[]\n")
+	}
+}
+
+func TestStatusSkipsManifests(t *testing.T) {
+	defer testGitRepo(t)()
+
+	ioutil.WriteFile("secrets.dev.yaml", secretManifests, 0644)
+	ioutil.WriteFile("values.dev.yaml", []byte("password: secret\n"), 0644)
+	s := &Sealit{config: &Config{SealingRuleSets: []SealingRuleSet{{FileRegex: `\.dev\.yaml$`, Cert: &Cert{}}}}}
+
+	status, err := s.fileStatus()
+	if err != nil {
+		t.Fatalf("Status was unsuccessful, got an error %s.", err.Error())
+	}
+
+	if len(status) != 1 || status[0].File != "values.dev.yaml" {
+		t.Errorf("Status was incorrect, got: %v.", status)
+	}
+}
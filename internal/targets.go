@@ -0,0 +1,329 @@
+package internal
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Error of secrets, which are sealed as a single value instead of a value per target
+const singleClusterError = "key `%s` is sealed for a single cluster only, run `sealit reseal` to seal it for every target"
+
+// sealTargets seals every secret for all targets of the rule set and returns the sealed files
+func sealTargets(srs *SealingRuleSet, vf valuesFile, fetchCert bool) ([]string, error) {
+	if err := splitTargets(srs, vf, "", nil); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	m := vf.getMetadata()
+
+	for _, t := range srs.Targets {
+		log.Printf("[DEBUG] Seal values for target %s", t.Name)
+		tm := m.targetMetadata(t.Name)
+
+		sealer, err := NewSealer(srs.forTarget(t), tm, fetchCert)
+		if err != nil {
+			return nil, fmt.Errorf("for target %s %s", t.Name, err.Error())
+		}
+
+		if err := vf.applyFuncToTarget(t.Name, sealer.Seal); err != nil {
+			return nil, fmt.Errorf("for target %s %s", t.Name, err.Error())
+		}
+
+		m.setTargetMetadata(t.Name, tm)
+
+		for _, file := range sealer.files {
+			if !containsString(files, file) {
+				files = append(files, file)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// verifyTargets verifies that every secret is sealed for all targets of the rule set
+func verifyTargets(srs *SealingRuleSet, vf valuesFile, fetchCert bool, strict bool) error {
+	secretsRegexp := srs.GetSecretsRegex()
+	prefix := srs.GetEncryptionPrefix()
+	targets := srs.targetNames()
+	m := vf.getMetadata()
+
+	err := vf.applyFuncToTargetMaps(func(path string, key *yaml.Node, value *yaml.Node) error {
+		if !isSecretOfFile(secretsRegexp, m, path, key, value) {
+			return nil
+		}
+
+		if value.Kind == yaml.MappingNode {
+			if missing := missingTargets(value, targets); len(missing) > 0 {
+				return fmt.Errorf("key `%s` is not sealed for target `%s`", key.Value, strings.Join(missing, "`, `"))
+			}
+		} else if strings.HasPrefix(value.Value, prefix) {
+			return fmt.Errorf(singleClusterError, key.Value)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, t := range srs.Targets {
+		tsrs := srs.forTarget(t)
+		tm := m.targetMetadata(t.Name)
+
+		if strict && !tm.isEmpty() {
+			log.Printf("[DEBUG] Verify embedded cert of target %s against the cert source", t.Name)
+			if err := verifyEmbeddedCert(tsrs, tm); err != nil {
+				return fmt.Errorf("for target %s %s", t.Name, err.Error())
+			}
+		}
+
+		sealer, err := NewSealer(tsrs, tm, fetchCert)
+		if err != nil {
+			return fmt.Errorf("for target %s %s", t.Name, err.Error())
+		}
+
+		if err := vf.applyFuncToTarget(t.Name, sealer.Verify); err != nil {
+			return fmt.Errorf("for target %s %s", t.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// resealTargets reseals every secret for all targets of the rule set. Values of targets which were added
+// to the rule set and values sealed before targets were configured are decrypted. The fingerprints
+// of historical controller keys, with which values were sealed, are returned.
+func resealTargets(srs *SealingRuleSet, vf valuesFile, outdatedOnly bool, oldPrefix string) ([]string, error) {
+	m := vf.getMetadata()
+	resealers := make([]*Resealer, len(srs.Targets))
+
+	for i, t := range srs.Targets {
+		r, err := NewResealer(srs.forTarget(t), m.targetMetadata(t.Name), outdatedOnly, oldPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("for target %s %s", t.Name, err.Error())
+		}
+
+		resealers[i] = r
+	}
+
+	return resealTargetsWith(srs, vf, resealers)
+}
+
+// resealTargetsWith reseals the values of every target with the resealer of the target
+func resealTargetsWith(srs *SealingRuleSet, vf valuesFile, resealers []*Resealer) ([]string, error) {
+	m := vf.getMetadata()
+	privateKeys := map[string]*rsa.PrivateKey{}
+
+	for _, r := range resealers {
+		for fingerprint, key := range r.privateKeys {
+			privateKeys[fingerprint] = key
+		}
+	}
+
+	label := m.getLabel()
+	err := splitTargets(srs, vf, resealers[0].oldPrefix, func(value *yaml.Node) ([]byte, error) {
+		entries := []*yaml.Node{value}
+		if value.Kind == yaml.MappingNode {
+			entries = nil
+			for i := 1; i < len(value.Content); i = i + 2 {
+				entries = append(entries, value.Content[i])
+			}
+		}
+
+		for _, entry := range entries {
+			if prefix, ok := resealers[0].sealedWithPrefix(entry.Value); ok {
+				return decryptValue(privateKeys, label, strings.TrimPrefix(entry.Value, prefix))
+			}
+		}
+
+		// Values which are not sealed for any target yet are copied
+		plaintext, _, err := readPlaintext(entries[0])
+
+		return plaintext, err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var historicalKeys []string
+
+	for i, t := range srs.Targets {
+		log.Printf("[DEBUG] Reseal values for target %s", t.Name)
+		if err := vf.applyFuncToTarget(t.Name, resealers[i].Reseal); err != nil {
+			return nil, fmt.Errorf("for target %s %s", t.Name, err.Error())
+		}
+
+		resealers[i].UpdateMetadata()
+		m.setTargetMetadata(t.Name, resealers[i].metadata)
+
+		for _, fingerprint := range resealers[i].historicalKeys {
+			if !containsString(historicalKeys, fingerprint) {
+				historicalKeys = append(historicalKeys, fingerprint)
+			}
+		}
+	}
+
+	return historicalKeys, nil
+}
+
+// unsealTargets decrypts the values of all targets, values which are equal for all targets are joined
+func unsealTargets(srs *SealingRuleSet, vf valuesFile) error {
+	m := vf.getMetadata()
+
+	for _, t := range srs.Targets {
+		log.Printf("[DEBUG] Unseal values of target %s", t.Name)
+		tm := m.targetMetadata(t.Name)
+
+		unsealer, err := NewUnsealer(srs.forTarget(t), tm)
+		if err != nil {
+			return fmt.Errorf("for target %s %s", t.Name, err.Error())
+		}
+
+		if err := vf.applyFuncToTarget(t.Name, unsealer.Unseal); err != nil {
+			return fmt.Errorf("for target %s %s", t.Name, err.Error())
+		}
+
+		m.setTargetMetadata(t.Name, tm)
+	}
+
+	return joinTargets(srs, vf)
+}
+
+// splitTargets replaces every unsealed secret by a target map with a copy of the value for every target.
+// Without a function for reading the plaintext of a secret, target maps lacking targets and values sealed
+// for a single cluster, with the prefix of the rule set or the old prefix, are an error.
+func splitTargets(srs *SealingRuleSet, vf valuesFile, oldPrefix string, plaintextOf func(*yaml.Node) ([]byte, error)) error {
+	secretsRegexp := srs.GetSecretsRegex()
+	prefix := srs.GetEncryptionPrefix()
+	targets := srs.targetNames()
+	m := vf.getMetadata()
+
+	return vf.applyFuncToTargetMaps(func(path string, key *yaml.Node, value *yaml.Node) error {
+		if !isSecretOfFile(secretsRegexp, m, path, key, value) {
+			return nil
+		}
+
+		var missing []string
+		if value.Kind == yaml.ScalarNode {
+			if !strings.HasPrefix(value.Value, prefix) && (oldPrefix == "" || !strings.HasPrefix(value.Value, oldPrefix)) {
+				log.Printf("[DEBUG] Split value of `%s` into a value per target", key.Value)
+				splitValue(value, targets)
+
+				return nil
+			}
+
+			if plaintextOf == nil {
+				return fmt.Errorf(singleClusterError, key.Value)
+			}
+		} else if missing = missingTargets(value, targets); len(missing) == 0 {
+			return nil
+		} else if plaintextOf == nil {
+			return fmt.Errorf("key `%s` has no value for target `%s`, run `sealit reseal` to add it", key.Value, strings.Join(missing, "`, `"))
+		}
+
+		plaintext, err := plaintextOf(value)
+		if err != nil {
+			return err
+		}
+
+		if value.Kind == yaml.ScalarNode {
+			log.Printf("[DEBUG] Split value of `%s` sealed for a single cluster into a value per target", key.Value)
+			value.SetString(string(plaintext))
+			splitValue(value, targets)
+
+			return nil
+		}
+
+		for _, target := range missing {
+			log.Printf("[DEBUG] Add value of `%s` for target %s", key.Value, target)
+			entry := &yaml.Node{Kind: yaml.ScalarNode}
+			entry.SetString(string(plaintext))
+			value.Content = append(value.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: target}, entry)
+		}
+
+		return nil
+	})
+}
+
+// joinTargets replaces target maps of secrets whose values are equal for all targets by the value
+func joinTargets(srs *SealingRuleSet, vf valuesFile) error {
+	secretsRegexp := srs.GetSecretsRegex()
+	prefix := srs.GetEncryptionPrefix()
+	m := vf.getMetadata()
+
+	return vf.applyFuncToTargetMaps(func(path string, key *yaml.Node, value *yaml.Node) error {
+		if value.Kind != yaml.MappingNode || !isSecretOfFile(secretsRegexp, m, path, key, value.Content[1]) {
+			return nil
+		}
+
+		first := value.Content[1]
+		for i := 1; i < len(value.Content); i = i + 2 {
+			entry := value.Content[i]
+			if entry.Value != first.Value || entry.ShortTag() != first.ShortTag() || strings.HasPrefix(entry.Value, prefix) {
+				return nil
+			}
+		}
+
+		log.Printf("[DEBUG] Join values of `%s` as they are equal for all targets", key.Value)
+		*value = *first
+
+		return nil
+	})
+}
+
+// isSecretOfFile checks if the value is a secret, respecting the file references recorded in the metadata of
+// the file and of its targets. Paths of targets are recorded with the target, like `tls_key.production`.
+func isSecretOfFile(secretsRegexp *regexp.Regexp, m *Metadata, path string, key *yaml.Node, value *yaml.Node) bool {
+	if isSecret(secretsRegexp, m, path, key, value) {
+		return true
+	}
+
+	for target := range m.Targets {
+		tm := m.targetMetadata(target)
+		if isSecret(secretsRegexp, tm, path, key, value) || isSecret(secretsRegexp, tm, joinPath(path, target), key, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitValue turns the scalar into a target map with a copy of the scalar for every target
+func splitValue(value *yaml.Node, targets []string) {
+	entry := *value
+	value.Kind, value.Tag, value.Value, value.Style = yaml.MappingNode, "!!map", "", 0
+	value.Content = nil
+	value.HeadComment, value.LineComment, value.FootComment = "", "", ""
+
+	for i, target := range targets {
+		copied := entry
+		// Comments are kept at the entry of the first target only
+		if i > 0 {
+			copied.HeadComment, copied.LineComment, copied.FootComment = "", "", ""
+		}
+
+		value.Content = append(value.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: target}, &copied)
+	}
+}
+
+// missingTargets returns the targets without an entry in the target map
+func missingTargets(value *yaml.Node, targets []string) []string {
+	var missing []string
+
+	for _, target := range targets {
+		if getValue(value, target) == nil {
+			missing = append(missing, target)
+		}
+	}
+
+	return missing
+}
@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"crypto/rsa"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
+	"gopkg.in/yaml.v3"
+)
+
+func testTargetsRuleSet(keys ...*rsa.PrivateKey) (*SealingRuleSet, func()) {
+	srs := &SealingRuleSet{Name: "app", Namespace: "default", SecretsRegex: "password$"}
+	var cleanups []func()
+
+	for i, key := range keys {
+		target, cleanup := testPathRuleSet(testGenerateCert(key, time.Now().Add(-time.Hour), time.Now().Add(time.Hour)))
+		srs.Targets = append(srs.Targets, Target{Name: []string{"production", "staging"}[i], Cert: target.Cert})
+		cleanups = append(cleanups, cleanup)
+	}
+
+	return srs, func() {
+		for _, cleanup := range cleanups {
+			cleanup()
+		}
+	}
+}
+
+func TestSealTargets(t *testing.T) {
+	productionKey, _ := testGeneratePrivateKey()
+	stagingKey, _ := rsa.GenerateKey(rand.New(rand.NewSource(7)), 2048)
+	srs, cleanup := testTargetsRuleSet(productionKey, stagingKey)
+	defer cleanup()
+
+	vf, _ := loadValuesFile(srs, "values.yaml", []byte("db_password: hunter2\nreplicas: 2\n"), srs.GetMetadataKey())
+
+	if _, err := sealTargets(srs, vf, false); err != nil {
+		t.Fatalf("Sealing was unsuccessful, got an error %s.", err.Error())
+	}
+
+	m := vf.getMetadata()
+	label := m.getLabel()
+	entries := getValue(vf.(*File).values.Content[0], "db_password")
+
+	for target, key := range map[string]*rsa.PrivateKey{"production": productionKey, "staging": stagingKey} {
+		entry := getValue(entries, target)
+		plaintext, err := decryptValue(map[string]*rsa.PrivateKey{"": key}, label, strings.TrimPrefix(entry.Value, encodeIdentifier))
+
+		if err != nil || string(plaintext) != "hunter2" {
+			t.Errorf("Value of target %s was incorrect, got: %s.", target, entry.Value)
+		}
+
+		if m.Targets[target] == nil || m.Targets[target].Secrets["db_password."+target] == nil {
+			t.Errorf("Metadata of target %s was incorrect, got: %+v.", target, m.Targets[target])
+		}
+	}
+
+	if err := verifyTargets(srs, vf, false, false); err != nil {
+		t.Errorf("Verify was unsuccessful, got an error %s.", err.Error())
+	}
+
+	entries.Content = entries.Content[:2]
+
+	if err := verifyTargets(srs, vf, false, false); err == nil || err.Error() != "at path db_password key `db_password` is not sealed for target `staging`" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+
+	if _, err := sealTargets(srs, vf, false); err == nil || !strings.Contains(err.Error(), "run `sealit reseal` to add it") {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+}
+
+func TestSplitAndJoinTargets(t *testing.T) {
+	srs := &SealingRuleSet{SecretsRegex: "password$", Targets: []Target{{Name: "production"}, {Name: "staging"}}}
+	values := `db_password: hunter2 # the db
+api_password:
+    production: prod
+    staging: stage
+replicas:
+    production: 3
+`
+
+	vf, _ := loadValuesFile(srs, "values.yaml", []byte(values), srs.GetMetadataKey())
+	if err := splitTargets(srs, vf, "", nil); err != nil {
+		t.Fatalf("Splitting was unsuccessful, got an error %s.", err.Error())
+	}
+
+	var paths []string
+	vf.ApplyFuncToValues(func(path string, key *yaml.Node, value *yaml.Node) error {
+		paths = append(paths, path+"="+key.Value)
+		return nil
+	})
+
+	if strings.Join(paths, ",") != "db_password.production=db_password,db_password.staging=db_password,api_password.production=api_password,api_password.staging=api_password,replicas.production=replicas" {
+		t.Errorf("Paths were incorrect, got: %v.", paths)
+	}
+
+	if err := joinTargets(srs, vf); err != nil {
+		t.Fatalf("Joining was unsuccessful, got an error %s.", err.Error())
+	}
+
+	d, _ := yaml.Marshal(vf.(*File).values)
+
+	if string(d) != values {
+		t.Errorf("Joined values were incorrect, got: \n%s\n, want: \n%s\n.", d, values)
+	}
+}
+
+func TestTargetsOfFileReference(t *testing.T) {
+	srs := &SealingRuleSet{SecretsRegex: "password$", Targets: []Target{{Name: "production"}, {Name: "staging"}}}
+	values := `tls_key:
+    production: ENC:abc
+sealit:
+    targets:
+        production:
+            secrets:
+                tls_key.production:
+                    file: tls.key
+`
+
+	vf, _ := loadValuesFile(srs, "values.yaml", []byte(values), srs.GetMetadataKey())
+
+	if err := verifyTargets(srs, vf, false, false); err == nil || err.Error() != "at path tls_key key `tls_key` is not sealed for target `staging`" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+
+	if err := splitTargets(srs, vf, "", nil); err == nil || !strings.Contains(err.Error(), "key `tls_key` has no value for target `staging`") {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+}
+
+func TestResealTargets(t *testing.T) {
+	productionKey, _ := testGeneratePrivateKey()
+	stagingKey, _ := rsa.GenerateKey(rand.New(rand.NewSource(7)), 2048)
+	srs, cleanup := testTargetsRuleSet(productionKey, stagingKey)
+	defer cleanup()
+
+	// The file was sealed for production only and db_password before targets were configured
+	sealed, _ := loadValuesFile(srs, "values.yaml", []byte("db_password: hunter2\napi_password: s3cret\n"), srs.GetMetadataKey())
+	production := &SealingRuleSet{Name: srs.Name, Namespace: srs.Namespace, SecretsRegex: srs.SecretsRegex, Cert: srs.Targets[0].Cert}
+	sealer, _ := NewSealer(production, sealed.getMetadata(), false)
+	if err := sealed.ApplyFuncToValues(sealer.Seal); err != nil {
+		t.Fatalf("Sealing was unsuccessful, got an error %s.", err.Error())
+	}
+
+	values := sealed.(*File).values.Content[0]
+	apiPassword := getValue(values, "api_password")
+	*apiPassword = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "production"}, {Kind: yaml.ScalarNode, Value: apiPassword.Value}}}
+
+	vf := sealed
+
+	if err := verifyTargets(srs, vf, false, false); err == nil || !strings.Contains(err.Error(), "key `db_password` is sealed for a single cluster only") {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+
+	if _, err := sealTargets(srs, vf, false); err == nil || !strings.Contains(err.Error(), "key `db_password` is sealed for a single cluster only") {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+
+	m := vf.getMetadata()
+	var resealers []*Resealer
+	for i, key := range []*rsa.PrivateKey{productionKey, stagingKey} {
+		fp, _ := crypto.PublicKeyFingerprint(&key.PublicKey)
+		cert, _ := srs.forTarget(srs.Targets[i]).GetCert()
+		resealers = append(resealers, &Resealer{
+			secretsRegexp: srs.GetSecretsRegex(),
+			prefix:        encodeIdentifier,
+			oldPrefix:     encodeIdentifier,
+			publicKey:     &key.PublicKey,
+			fingerprint:   fp,
+			privateKeys:   map[string]*rsa.PrivateKey{fp: key},
+			label:         m.getLabel(),
+			newLabel:      srs.getLabel(),
+			newMetadata:   Metadata{Name: srs.Name, Namespace: srs.Namespace, Cert: cert},
+			metadata:      m.targetMetadata(srs.Targets[i].Name),
+		})
+	}
+
+	if _, err := resealTargetsWith(srs, vf, resealers); err != nil {
+		t.Fatalf("Resealing was unsuccessful, got an error %s.", err.Error())
+	}
+
+	for target, key := range map[string]*rsa.PrivateKey{"production": productionKey, "staging": stagingKey} {
+		for secret, want := range map[string]string{"db_password": "hunter2", "api_password": "s3cret"} {
+			entry := getValue(getValue(values, secret), target)
+			plaintext, err := decryptValue(map[string]*rsa.PrivateKey{"": key}, srs.getLabel(), strings.TrimPrefix(entry.Value, encodeIdentifier))
+
+			if err != nil || string(plaintext) != want {
+				t.Errorf("Value of %s for target %s was incorrect, got: %s, %v.", secret, target, plaintext, err)
+			}
+		}
+	}
+
+	if err := verifyTargets(srs, vf, false, false); err != nil {
+		t.Errorf("Verify was unsuccessful, got an error %s.", err.Error())
+	}
+}
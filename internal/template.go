@@ -0,0 +1,344 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source for this template is https://github.com/bitnami-labs/sealed-secrets#sealedsecrets-as-templates-for-secrets
+var template = `apiVersion: bitnami.com/v1alpha1
+kind: SealedSecret
+metadata:
+  # Secrets sealed namespace-wide or cluster-wide have no name, the name of the release is used instead
+  name: {{ .Values.sealit.name | default .Release.Name }}
+  {{- if (ne "" .Values.sealit.namespace) }}
+  namespace: {{ .Values.sealit.namespace }}
+  {{- end }}
+` + templateLabels + `{{- if or (eq "" .Values.sealit.namespace) (eq "" .Values.sealit.name) }}
+  annotations:
+  {{- if (eq "" .Values.sealit.namespace) }}
+    "sealedsecrets.bitnami.com/cluster-wide": "true"
+  {{- else }}
+    "sealedsecrets.bitnami.com/namespace-wide": "true"
+  {{- end }}
+{{- end }}
+spec:
+  encryptedData:
+`
+
+const templateLabels = `  labels:
+    {{- include "sample-chart.labels" . | nindent 4 }}
+`
+
+const templateExample = `    # Here you list your env variables. Do not forget to trim the prefixed "ENC:"!
+    #PASSWORD: {{ .Values.env.password | trimPrefix "ENC:" }}
+`
+
+// Named templates for charts, which generate the encrypted data and scope annotations from the values
+var helperTemplate = `{{/*
+Generated by sealit. Emits an encryptedData entry for every string with the "ENC:" prefix within the values.
+Entries are named after their path below the values joined by "_", entries of lists are suffixed with their index.
+Usage:
+  encryptedData:
+    {{- include "sealit.encryptedData" .Values.env | nindent 4 }}
+*/}}
+{{- define "sealit.encryptedData" -}}
+{{- include "sealit.encryptedDataEntries" (dict "values" . "path" "") -}}
+{{- end -}}
+
+{{- define "sealit.encryptedDataEntries" -}}
+{{- $path := .path -}}
+{{- range $key, $value := .values -}}
+{{- if ne $key "sealit" -}}
+{{- $name := regexReplaceAll "[^-._a-zA-Z0-9]" (trimPrefix "_" (printf "%s_%s" $path $key)) "_" -}}
+{{- if kindIs "map" $value -}}
+{{- include "sealit.encryptedDataEntries" (dict "values" $value "path" $name) -}}
+{{- else if kindIs "slice" $value -}}
+{{- range $index, $item := $value -}}
+{{- if kindIs "map" $item -}}
+{{- include "sealit.encryptedDataEntries" (dict "values" $item "path" (printf "%s_%d" $name $index)) -}}
+{{- else if kindIs "string" $item -}}
+{{- if hasPrefix "ENC:" $item -}}
+{{- printf "%s_%d: %s\n" $name $index (trimPrefix "ENC:" $item) -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- else if kindIs "string" $value -}}
+{{- if hasPrefix "ENC:" $value -}}
+{{- printf "%s: %s\n" $name (trimPrefix "ENC:" $value) -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Generated by sealit. Emits the scope annotations of the SealedSecret based on .Values.sealit
+Usage:
+  {{- with include "sealit.annotations" . }}
+  annotations:
+    {{- . | nindent 4 }}
+  {{- end }}
+*/}}
+{{- define "sealit.annotations" -}}
+{{- if eq "" .Values.sealit.namespace -}}
+"sealedsecrets.bitnami.com/cluster-wide": "true"
+{{- else if eq "" .Values.sealit.name -}}
+"sealedsecrets.bitnami.com/namespace-wide": "true"
+{{- end -}}
+{{- end -}}
+`
+
+// Characters which are not allowed within the keys of a secret
+var invalidSecretKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+// Template creates a SealedSecret resource, which honors the prefix and metadata key of the sealing rule set.
+// With a values file an entry of `encryptedData` is generated for every sealed value of the file.
+// The labels are included from the helper of the chart, which is by default the parent of the template folder.
+// With helper set, the named templates for the chart are created instead.
+func Template(sealitconfig string, sealedSecretPath string, valuesPath string, chartPath string, helper bool) (err error) {
+	srs, err := loadSealingRuleSet(sealitconfig, valuesPath)
+	if err != nil {
+		return err
+	}
+
+	if helper {
+		return writeTemplate(sealedSecretPath, strings.NewReplacer(
+			`"ENC:"`, strconv.Quote(srs.GetEncryptionPrefix()),
+			".Values.sealit", valuesReference(srs.GetMetadataKey()),
+			`ne $key "sealit"`, fmt.Sprintf("ne $key %s", strconv.Quote(srs.GetMetadataKey())),
+		).Replace(helperTemplate))
+	}
+
+	if chartPath == "" && sealedSecretPath != "" {
+		chartPath = filepath.Dir(filepath.Dir(sealedSecretPath))
+	} else if chartPath == "" {
+		chartPath = "."
+	}
+
+	labels := ""
+	if chartName := readChartName(chartPath); chartName != "" {
+		labels = strings.Replace(templateLabels, "sample-chart", chartName, 1)
+	}
+
+	t := strings.NewReplacer(
+		`"ENC:"`, strconv.Quote(srs.GetEncryptionPrefix()),
+		".Values.sealit", valuesReference(srs.GetMetadataKey()),
+		templateLabels, labels,
+	).Replace(template)
+
+	if valuesPath == "" {
+		t += strings.ReplaceAll(templateExample, `"ENC:"`, strconv.Quote(srs.GetEncryptionPrefix()))
+	} else {
+		entries, err := encryptedDataEntries(srs, valuesPath)
+		if err != nil {
+			return err
+		}
+
+		t += entries
+	}
+
+	return writeTemplate(sealedSecretPath, t)
+}
+
+// writeTemplate writes the template to the path or prints it, if no path is provided
+func writeTemplate(path string, t string) error {
+	if path == "" {
+		fmt.Printf("%s", t)
+		return nil
+	}
+
+	return ioutil.WriteFile(path, []byte(t), 0644)
+}
+
+// loadSealingRuleSet returns the first sealing rule set matching the file or the first one of the config file.
+// The defaults are used, in case the config file can not be read.
+func loadSealingRuleSet(sealitconfig string, path string) (*SealingRuleSet, error) {
+	ruleSets, err := loadSealingRuleSets(sealitconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ruleSets) == 0 {
+		return &SealingRuleSet{}, nil
+	}
+
+	if path != "" {
+		for i, srs := range ruleSets {
+			if regexp.MustCompile(srs.FileRegex).MatchString(filepath.Base(path)) {
+				return &ruleSets[i], nil
+			}
+		}
+	}
+
+	return &ruleSets[0], nil
+}
+
+// loadSealingRuleSets returns all sealing rule sets of the config file, none in case the config file can not be read
+func loadSealingRuleSets(sealitconfig string) ([]SealingRuleSet, error) {
+	configFile, err := ioutil.ReadFile(sealitconfig)
+	if err != nil {
+		log.Printf("[DEBUG] Use default prefix and metadata key, as config file %s can not be read", sealitconfig)
+		return nil, nil
+	}
+
+	config, err := LoadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.SealingRuleSets, nil
+}
+
+// readChartName returns the name of the chart or an empty string, if the `Chart.yaml` can not be read
+func readChartName(chartPath string) string {
+	d, err := ioutil.ReadFile(filepath.Join(chartPath, "Chart.yaml"))
+	if err != nil {
+		log.Printf("[DEBUG] Skip labels, as the Chart.yaml in %s can not be read", chartPath)
+		return ""
+	}
+
+	var chart struct {
+		Name string `yaml:"name"`
+	}
+
+	if err := yaml.Unmarshal(d, &chart); err != nil {
+		log.Printf("[DEBUG] Skip labels, as the Chart.yaml in %s is invalid", chartPath)
+		return ""
+	}
+
+	return chart.Name
+}
+
+// encryptedDataEntries returns an entry of `encryptedData` for every sealed value of the values file
+func encryptedDataEntries(srs *SealingRuleSet, valuesPath string) (string, error) {
+	if srs.getFormat(filepath.Base(valuesPath)) != yamlFormat {
+		return "", errors.New("templates can only be generated from yaml values files")
+	}
+
+	d, err := ioutil.ReadFile(valuesPath)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := newValueFileWithMetadataKey(d, srs.GetMetadataKey())
+	if err != nil {
+		return "", err
+	}
+
+	var paths [][]interface{}
+	if len(f.values.Content) > 0 {
+		paths = findSealedValues(f.values.Content[0], nil, srs.GetEncryptionPrefix(), srs.GetMetadataKey())
+	}
+
+	if len(paths) == 0 {
+		return "", fmt.Errorf("file %s has no sealed values, run `sealit seal` first", valuesPath)
+	}
+
+	var b strings.Builder
+	keys := secretKeys(paths)
+
+	for i, path := range paths {
+		b.WriteString(fmt.Sprintf("    %s: {{ %s | trimPrefix %s }}\n", keys[i], valuesReference(path...), strconv.Quote(srs.GetEncryptionPrefix())))
+	}
+
+	return b.String(), nil
+}
+
+// findSealedValues returns the keys and indexes of all values with the prefix
+func findSealedValues(node *yaml.Node, path []interface{}, prefix string, metadataKey string) [][]interface{} {
+	var paths [][]interface{}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content); i = i + 2 {
+			if node.Content[i].Value != metadataKey {
+				paths = append(paths, findSealedValues(node.Content[i+1], appendPath(path, node.Content[i].Value), prefix, metadataKey)...)
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			paths = append(paths, findSealedValues(child, appendPath(path, i), prefix, metadataKey)...)
+		}
+	case yaml.ScalarNode:
+		if strings.HasPrefix(node.Value, prefix) {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+func appendPath(path []interface{}, key interface{}) []interface{} {
+	return append(append([]interface{}{}, path...), key)
+}
+
+// secretKeys names the entries of `encryptedData` after the key of the value,
+// values whose keys are not unique are named after their whole path
+func secretKeys(paths [][]interface{}) []string {
+	keys := make([]string, len(paths))
+	count := map[string]int{}
+
+	for i, path := range paths {
+		start := 0
+		for j, key := range path {
+			if _, ok := key.(string); ok {
+				start = j
+			}
+		}
+
+		keys[i] = secretKey(path[start:])
+		count[keys[i]]++
+	}
+
+	for i, path := range paths {
+		if count[keys[i]] > 1 {
+			keys[i] = secretKey(path)
+		}
+	}
+
+	return keys
+}
+
+func secretKey(path []interface{}) string {
+	parts := make([]string, len(path))
+	for i, key := range path {
+		parts[i] = fmt.Sprint(key)
+	}
+
+	return invalidSecretKeyChars.ReplaceAllString(strings.Join(parts, "_"), "_")
+}
+
+// valuesReference returns the Helm template reference to the values of the path,
+// integers are indexes of sequences
+func valuesReference(keys ...interface{}) string {
+	identifier := regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	reference := ".Values"
+
+	for _, key := range keys {
+		if s, ok := key.(string); !ok || !identifier.MatchString(s) {
+			args := make([]string, len(keys))
+			for i, k := range keys {
+				if s, ok := k.(string); ok {
+					args[i] = strconv.Quote(s)
+				} else {
+					args[i] = fmt.Sprint(k)
+				}
+			}
+
+			return fmt.Sprintf("(index .Values %s)", strings.Join(args, " "))
+		}
+
+		reference = fmt.Sprintf("%s.%s", reference, key)
+	}
+
+	return reference
+}
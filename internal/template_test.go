@@ -0,0 +1,275 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	gotemplate "text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+var sealedValuesFile = []byte(`env:
+    username: john
+    password: ENC:AgBy3i4O
+    db-password: ENC:AgCx7Dc5
+env2:
+    password: ENC:AgDa3kd8
+    tokens:
+      - ENC:AgEe4Lm1
+sealit:
+    name: secret
+    namespace: default
+    cert: ENC:not-a-secret
+`)
+
+func TestValuesReference(t *testing.T) {
+	if r := valuesReference("sealit", "name"); r != ".Values.sealit.name" {
+		t.Errorf("Reference was incorrect, got: %s, want: %s.", r, ".Values.sealit.name")
+	}
+
+	if r := valuesReference("sealing-info", "name"); r != `(index .Values "sealing-info" "name")` {
+		t.Errorf("Reference was incorrect, got: %s, want: %s.", r, `(index .Values "sealing-info" "name")`)
+	}
+
+	if r := valuesReference("env", "tokens", 0); r != `(index .Values "env" "tokens" 0)` {
+		t.Errorf("Reference was incorrect, got: %s, want: %s.", r, `(index .Values "env" "tokens" 0)`)
+	}
+}
+
+func TestEncryptedDataEntries(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "template")
+	defer os.RemoveAll(dir)
+
+	valuesPath := filepath.Join(dir, "values.prod.yaml")
+	ioutil.WriteFile(valuesPath, sealedValuesFile, 0644)
+
+	entries, err := encryptedDataEntries(&SealingRuleSet{}, valuesPath)
+	if err != nil {
+		t.Fatalf("Generating entries was unsuccessful, got an error %s.", err.Error())
+	}
+
+	expected := `    env_password: {{ .Values.env.password | trimPrefix "ENC:" }}
+    db-password: {{ (index .Values "env" "db-password") | trimPrefix "ENC:" }}
+    env2_password: {{ .Values.env2.password | trimPrefix "ENC:" }}
+    tokens_0: {{ (index .Values "env2" "tokens" 0) | trimPrefix "ENC:" }}
+`
+
+	if entries != expected {
+		t.Errorf("Entries were incorrect, got: \n%s\n, want: \n%s\n.", entries, expected)
+	}
+}
+
+func TestEncryptedDataEntriesWithoutSealedValues(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "template")
+	defer os.RemoveAll(dir)
+
+	valuesPath := filepath.Join(dir, "values.yaml")
+	ioutil.WriteFile(valuesPath, untransformedDataImport, 0644)
+
+	if _, err := encryptedDataEntries(&SealingRuleSet{}, valuesPath); err == nil {
+		t.Error("Expected an error but got non")
+	}
+}
+
+func TestSecretKeys(t *testing.T) {
+	keys := secretKeys([][]interface{}{
+		{"env", "password"},
+		{"env2", "password"},
+		{"env", "api.token"},
+		{"env", "hosts", 1, "key"},
+		{"env", "list", 2},
+		{"env", "tls cert"},
+	})
+
+	expected := []string{"env_password", "env2_password", "api.token", "key", "list_2", "tls_cert"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Keys were incorrect, got: %v, want: %v.", keys, expected)
+	}
+}
+
+func TestReadChartName(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "chart")
+	defer os.RemoveAll(dir)
+
+	if name := readChartName(dir); name != "" {
+		t.Errorf("Chart name was incorrect, got: %s, want an empty name.", name)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("apiVersion: v2\nname: my-app\n"), 0644)
+
+	if name := readChartName(dir); name != "my-app" {
+		t.Errorf("Chart name was incorrect, got: %s, want: %s.", name, "my-app")
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "chart")
+	defer os.RemoveAll(dir)
+
+	os.Mkdir(filepath.Join(dir, "templates"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("name: my-app\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "values.prod.yaml"), sealedValuesFile, 0644)
+
+	templatePath := filepath.Join(dir, "templates", "sealedsecret.yaml")
+	if err := Template(filepath.Join(dir, ".sealit.yaml"), templatePath, filepath.Join(dir, "values.prod.yaml"), "", false); err != nil {
+		t.Fatalf("Template was unsuccessful, got an error %s.", err.Error())
+	}
+
+	d, _ := ioutil.ReadFile(templatePath)
+
+	for _, expected := range []string{
+		"  name: {{ .Values.sealit.name | default .Release.Name }}\n",
+		"  namespace: {{ .Values.sealit.namespace }}\n",
+		`{{- include "my-app.labels" . | nindent 4 }}`,
+		`{{- if or (eq "" .Values.sealit.namespace) (eq "" .Values.sealit.name) }}`,
+		`    env_password: {{ .Values.env.password | trimPrefix "ENC:" }}`,
+	} {
+		if !strings.Contains(string(d), expected) {
+			t.Errorf("Template does not contain %s, got: \n%s", expected, d)
+		}
+	}
+}
+
+func TestTemplateWithoutChart(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "template")
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, ".sealit.yaml"), []byte(`sealingRules:
+  - fileRegex: \.yaml$
+    encryptionPrefix: "sealed:"
+    metadataKey: sealing-info
+`), 0644)
+
+	templatePath := filepath.Join(dir, "sealedsecret.yaml")
+	if err := Template(filepath.Join(dir, ".sealit.yaml"), templatePath, "", dir, false); err != nil {
+		t.Fatalf("Template was unsuccessful, got an error %s.", err.Error())
+	}
+
+	d, _ := ioutil.ReadFile(templatePath)
+
+	if strings.Contains(string(d), "labels:") {
+		t.Errorf("Template contains labels without a chart, got: \n%s", d)
+	}
+
+	if !strings.Contains(string(d), `(index .Values "sealing-info").name`) || !strings.Contains(string(d), `trimPrefix "sealed:"`) {
+		t.Errorf("Template does not honor the prefix and metadata key, got: \n%s", d)
+	}
+}
+
+// testRenderHelper renders the named template with the subset of the Helm functions used by the helper
+func testRenderHelper(t *testing.T, helper string, name string, data interface{}) string {
+	tmpl := gotemplate.New("helper")
+	tmpl.Funcs(gotemplate.FuncMap{
+		"kindIs":     func(kind string, v interface{}) bool { return v != nil && reflect.TypeOf(v).Kind().String() == kind },
+		"hasPrefix":  func(prefix string, s string) bool { return strings.HasPrefix(s, prefix) },
+		"trimPrefix": func(prefix string, s string) string { return strings.TrimPrefix(s, prefix) },
+		"regexReplaceAll": func(regex string, s string, repl string) string {
+			return regexp.MustCompile(regex).ReplaceAllString(s, repl)
+		},
+		"dict": func(pairs ...interface{}) map[string]interface{} {
+			d := map[string]interface{}{}
+			for i := 0; i < len(pairs); i = i + 2 {
+				d[pairs[i].(string)] = pairs[i+1]
+			}
+			return d
+		},
+		"include": func(name string, data interface{}) (string, error) {
+			var b bytes.Buffer
+			err := tmpl.ExecuteTemplate(&b, name, data)
+			return b.String(), err
+		},
+	})
+
+	if _, err := tmpl.Parse(helper); err != nil {
+		t.Fatalf("Helper can not be parsed, got an error %s.", err.Error())
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&b, name, data); err != nil {
+		t.Fatalf("Helper can not be rendered, got an error %s.", err.Error())
+	}
+
+	return b.String()
+}
+
+func TestHelperEncryptedData(t *testing.T) {
+	var values map[string]interface{}
+	yaml.Unmarshal(sealedValuesFile, &values)
+
+	d := testRenderHelper(t, helperTemplate, "sealit.encryptedData", values)
+	expected := "env_db-password: AgCx7Dc5\nenv_password: AgBy3i4O\nenv2_password: AgDa3kd8\nenv2_tokens_0: AgEe4Lm1\n"
+
+	if d != expected {
+		t.Errorf("Encrypted data was incorrect, got: \n%s\n, want: \n%s\n.", d, expected)
+	}
+}
+
+func TestHelperEncryptedDataOfNameValueList(t *testing.T) {
+	var values map[string]interface{}
+	yaml.Unmarshal([]byte("env:\n  - name: DB_PASSWORD\n    value: ENC:AgCx7Dc5\n  - name: API_PASSWORD\n    value: ENC:AgBy3i4O\n"), &values)
+
+	d := testRenderHelper(t, helperTemplate, "sealit.encryptedData", values)
+	expected := "env_0_value: AgCx7Dc5\nenv_1_value: AgBy3i4O\n"
+
+	if d != expected {
+		t.Errorf("Encrypted data was incorrect, got: \n%s\n, want: \n%s\n.", d, expected)
+	}
+}
+
+func TestHelperAnnotations(t *testing.T) {
+	scopes := map[string]string{
+		"name: app\nnamespace: default":  "",
+		"name: \"\"\nnamespace: default": `"sealedsecrets.bitnami.com/namespace-wide": "true"`,
+		"name: \"\"\nnamespace: \"\"":    `"sealedsecrets.bitnami.com/cluster-wide": "true"`,
+	}
+
+	for sealit, expected := range scopes {
+		var metadata map[string]interface{}
+		yaml.Unmarshal([]byte(sealit), &metadata)
+
+		d := testRenderHelper(t, helperTemplate, "sealit.annotations", map[string]interface{}{
+			"Values": map[string]interface{}{"sealit": metadata},
+		})
+
+		if d != expected {
+			t.Errorf("Annotations were incorrect, got: %s, want: %s.", d, expected)
+		}
+	}
+}
+
+func TestHelperWithCustomPrefixAndMetadataKey(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "template")
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, ".sealit.yaml"), []byte(`sealingRules:
+  - fileRegex: \.yaml$
+    encryptionPrefix: "sealed:"
+    metadataKey: sealing-info
+`), 0644)
+
+	helperPath := filepath.Join(dir, "_sealit.tpl")
+	if err := Template(filepath.Join(dir, ".sealit.yaml"), helperPath, "", "", true); err != nil {
+		t.Fatalf("Template was unsuccessful, got an error %s.", err.Error())
+	}
+
+	helper, _ := ioutil.ReadFile(helperPath)
+	d := testRenderHelper(t, string(helper), "sealit.encryptedData", map[string]interface{}{
+		"password":     "sealed:AgBy3i4O",
+		"username":     "ENC:john",
+		"sealing-info": map[string]interface{}{"cert": "sealed:not-a-secret"},
+	})
+
+	if d != "password: AgBy3i4O\n" {
+		t.Errorf("Encrypted data was incorrect, got: %s, want: %s.", d, "password: AgBy3i4O\n")
+	}
+
+	if !strings.Contains(string(helper), `(index .Values "sealing-info").namespace`) {
+		t.Errorf("Helper does not honor the metadata key, got: \n%s", helper)
+	}
+}
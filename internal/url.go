@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Timeout of fetching the cert from an url, unless `timeout` is set
+const defaultUrlTimeout = 30 * time.Second
+
+// Delay before the first retry of fetching the cert, it increases with every retry
+var urlRetryDelay = time.Second
+
+// UrlCertSource fetches the cert via HTTP(S). It is configured either by the url only or by a mapping,
+// credentials are referenced by the names of environment variables, so they are never committed.
+type UrlCertSource struct {
+	Url                  string            `yaml:"url"`
+	CertificateAuthority string            `yaml:"certificateAuthority,omitempty"`
+	ClientCertificate    string            `yaml:"clientCertificate,omitempty"`
+	ClientKey            string            `yaml:"clientKey,omitempty"`
+	TokenEnv             string            `yaml:"tokenEnv,omitempty"`
+	UsernameEnv          string            `yaml:"usernameEnv,omitempty"`
+	PasswordEnv          string            `yaml:"passwordEnv,omitempty"`
+	Headers              map[string]string `yaml:"headers,omitempty"`
+	Proxy                string            `yaml:"proxy,omitempty"`
+	Timeout              time.Duration     `yaml:"timeout,omitempty"`
+	Retries              int               `yaml:"retries,omitempty"`
+}
+
+// plainUrlCertSource has no methods, so it is decoded and encoded as mapping
+type plainUrlCertSource UrlCertSource
+
+// UnmarshalYAML accepts the url as plain string, as before the source had settings
+func (u *UrlCertSource) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*u = UrlCertSource{}
+		return value.Decode(&u.Url)
+	}
+
+	return value.Decode((*plainUrlCertSource)(u))
+}
+
+// MarshalYAML writes the url as plain string if no other setting is used
+func (u UrlCertSource) MarshalYAML() (interface{}, error) {
+	if !u.hasSettings() {
+		return u.Url, nil
+	}
+
+	return plainUrlCertSource(u), nil
+}
+
+// IsZero omits the source from the config if no url is set
+func (u UrlCertSource) IsZero() bool {
+	return u.Url == ""
+}
+
+// hasSettings reports whether any setting besides the url is used
+func (u UrlCertSource) hasSettings() bool {
+	return u.CertificateAuthority != "" || u.ClientCertificate != "" || u.ClientKey != "" ||
+		u.TokenEnv != "" || u.UsernameEnv != "" || u.PasswordEnv != "" || len(u.Headers) > 0 ||
+		u.Proxy != "" || u.Timeout != 0 || u.Retries != 0
+}
+
+func (u UrlCertSource) fetch() (io.ReadCloser, error) {
+	log.Print("[DEBUG] Fetch cert from url")
+	client, err := u.client()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := u.request()
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+
+		if err == nil {
+			if resp.StatusCode == http.StatusOK {
+				return resp.Body, nil
+			}
+
+			resp.Body.Close()
+			err = fmt.Errorf("cannot fetch %q: %s", u.Url, resp.Status)
+
+			// Only server errors and rate limits are worth a retry
+			if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+				return nil, err
+			}
+		}
+
+		if attempt >= u.Retries {
+			return nil, err
+		}
+
+		log.Printf("[DEBUG] Retry fetching the cert, attempt %d failed: %v", attempt+1, err)
+		time.Sleep(urlRetryDelay * time.Duration(attempt+1))
+	}
+}
+
+// client creates a HTTP client with the CA, client cert, proxy and timeout of the source
+func (u UrlCertSource) client() (*http.Client, error) {
+	tlsConfig := &tls.Config{}
+
+	if u.CertificateAuthority != "" {
+		ca, err := ioutil.ReadFile(u.CertificateAuthority)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA bundle: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("CA bundle %s contains no certificate", u.CertificateAuthority)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if u.ClientCertificate != "" || u.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(u.ClientCertificate, u.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %v", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if u.Proxy != "" {
+		proxyUrl, err := url.Parse(u.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy is invalid: %v", err)
+		}
+
+		proxy = http.ProxyURL(proxyUrl)
+	}
+
+	timeout := u.Timeout
+	if timeout == 0 {
+		timeout = defaultUrlTimeout
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{Proxy: proxy, TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+// request creates the request for the cert with the headers and the credentials of the environment
+func (u UrlCertSource) request() (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, u.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range u.Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+
+	if u.TokenEnv != "" {
+		token := os.Getenv(u.TokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("environment variable `%s` of the token is not set", u.TokenEnv)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if u.UsernameEnv != "" {
+		username := os.Getenv(u.UsernameEnv)
+		if username == "" {
+			return nil, fmt.Errorf("environment variable `%s` of the username is not set", u.UsernameEnv)
+		}
+
+		req.SetBasicAuth(username, os.Getenv(u.PasswordEnv))
+	}
+
+	return req, nil
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestUnmarshalUrlCertSource(t *testing.T) {
+	var sources Sources
+	yaml.Unmarshal([]byte("url: https://example.org/cert.pem\n"), &sources)
+
+	if sources.Url.Url != "https://example.org/cert.pem" {
+		t.Errorf("Url was incorrect, got: %+v.", sources.Url)
+	}
+
+	d, _ := yaml.Marshal(sources)
+	if string(d) != "url: https://example.org/cert.pem\n" {
+		t.Errorf("Marshaled source was incorrect, got: %s.", d)
+	}
+
+	yaml.Unmarshal([]byte("url:\n    url: https://example.org/cert.pem\n    tokenEnv: CERT_TOKEN\n    timeout: 5s\n    retries: 2\n"), &sources)
+
+	if sources.Url.Url != "https://example.org/cert.pem" || sources.Url.TokenEnv != "CERT_TOKEN" || sources.Url.Timeout != 5*time.Second || sources.Url.Retries != 2 {
+		t.Errorf("Url source was incorrect, got: %+v.", sources.Url)
+	}
+
+	d, _ = yaml.Marshal(sources)
+	if string(d) != "url:\n    url: https://example.org/cert.pem\n    tokenEnv: CERT_TOKEN\n    timeout: 5s\n    retries: 2\n" {
+		t.Errorf("Marshaled source was incorrect, got: %s.", d)
+	}
+}
+
+func TestFetchFromUrl(t *testing.T) {
+	attempts := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer secret-token" || r.Header.Get("X-Team") != "platform" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Write([]byte("cert"))
+	}))
+	defer server.Close()
+
+	ca, _ := ioutil.TempFile("", "ca")
+	pem.Encode(ca, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	ca.Close()
+	defer os.Remove(ca.Name())
+
+	os.Setenv("SEALIT_TEST_TOKEN", "secret-token")
+	defer os.Unsetenv("SEALIT_TEST_TOKEN")
+
+	delay := urlRetryDelay
+	urlRetryDelay = time.Millisecond
+	defer func() { urlRetryDelay = delay }()
+
+	source := UrlCertSource{
+		Url:                  server.URL,
+		CertificateAuthority: ca.Name(),
+		TokenEnv:             "SEALIT_TEST_TOKEN",
+		Headers:              map[string]string{"X-Team": "platform"},
+	}
+
+	if _, err := source.fetch(); err == nil {
+		t.Error("Expected an error but got non")
+	}
+
+	source.Retries = 1
+	attempts = 0
+	r, err := source.fetch()
+	if err != nil {
+		t.Fatalf("Fetching was unsuccessful, got an error %s.", err.Error())
+	}
+
+	cert, _ := ioutil.ReadAll(r)
+	if string(cert) != "cert" || attempts != 2 {
+		t.Errorf("Cert was incorrect, got: %s after %d attempts.", cert, attempts)
+	}
+
+	source.TokenEnv = "SEALIT_TEST_MISSING"
+	if _, err := source.fetch(); err == nil || err.Error() != "environment variable `SEALIT_TEST_MISSING` of the token is not set" {
+		t.Errorf("Error was incorrect, got: %v.", err)
+	}
+}
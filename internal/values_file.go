@@ -1,39 +1,124 @@
 package internal
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	ssv1alpha1 "github.com/bitnami-labs/sealed-secrets/pkg/apis/sealed-secrets/v1alpha1"
 	"gopkg.in/yaml.v3"
 )
 
+// Default key of the metadata block
 const sealitYamlKey = "sealit"
 
+// Fields of list entries like the `env` of a container, whose value is sealed if the name matches
+const (
+	defaultNameField  = "name"
+	defaultValueField = "value"
+)
+
+const (
+	yamlFormat       = "yaml"
+	dotenvFormat     = "dotenv"
+	propertiesFormat = "properties"
+)
+
+// valuesFile is implemented by all supported file formats
+type valuesFile interface {
+	ApplyFuncToValues(manipulator func(string, *yaml.Node, *yaml.Node) error) error
+	Export() ([]byte, error)
+	MoveMetadata(metadataKey string)
+	getMetadata() *Metadata
+	applyFuncToTarget(target string, manipulator func(string, *yaml.Node, *yaml.Node) error) error
+	applyFuncToTargetMaps(manipulator func(string, *yaml.Node, *yaml.Node) error) error
+}
+
 type File struct {
-	values   *yaml.Node
-	Metadata *Metadata `yaml:"sealit,omitempty"`
+	values      *yaml.Node
+	metadataKey string
+	nameField   string
+	valueField  string
+	targets     []string
+	// Entries of target maps are limited to this target, all are passed if empty
+	target string
+	// Target maps are passed as a whole instead of their entries
+	wholeTargets bool
+	// Content of a file without a document, like an empty file, which is exported unchanged
+	undocumented []byte
+	Metadata     *Metadata
 }
 
 type Metadata struct {
-	Name      string `yaml:"name"`
-	Namespace string `yaml:"namespace"`
-	SealedAt  string `yaml:"sealedAt"`
-	Cert      string `yaml:"cert"`
+	Version   int                        `yaml:"version"`
+	Name      string                     `yaml:"name"`
+	Namespace string                     `yaml:"namespace"`
+	SealedAt  string                     `yaml:"sealedAt"`
+	Cert      string                     `yaml:"cert"`
+	Secrets   map[string]*SecretMetadata `yaml:"secrets,omitempty"`
+	Targets   map[string]*TargetMetadata `yaml:"targets,omitempty"`
 }
 
-func NewValueFile(d []byte) (*File, error) {
-	log.Print("[DEBUG] Unmarshal file and prepare yaml nodes")
-	var f File
+// TargetMetadata keeps track of the cert and the sealed values of a single target
+type TargetMetadata struct {
+	SealedAt string                     `yaml:"sealedAt"`
+	Cert     string                     `yaml:"cert"`
+	Secrets  map[string]*SecretMetadata `yaml:"secrets,omitempty"`
+}
 
-	if err := yaml.Unmarshal(d, &f); err != nil {
-		return nil, err
-	}
+// SecretMetadata describes when and how the value of a single path was sealed
+type SecretMetadata struct {
+	SealedAt string `yaml:"sealedAt" json:"sealedAt"`
+	Cert     string `yaml:"cert" json:"cert"`
+	Scope    string `yaml:"scope" json:"scope"`
+	File     string `yaml:"file,omitempty" json:"file,omitempty"`
+	Tag      string `yaml:"tag,omitempty" json:"tag,omitempty"`
+	Style    string `yaml:"style,omitempty" json:"style,omitempty"`
+}
+
+// Names of the scalar styles recorded in the sealing metadata
+var scalarStyles = map[yaml.Style]string{
+	yaml.DoubleQuotedStyle: "double-quoted",
+	yaml.SingleQuotedStyle: "single-quoted",
+	yaml.LiteralStyle:      "literal",
+	yaml.FoldedStyle:       "folded",
+}
+
+// loadValuesFile loads the file in the format of the sealing rule set or the one indicated by its name
+func loadValuesFile(srs *SealingRuleSet, name string, d []byte, metadataKey string) (valuesFile, error) {
+	switch format := srs.getFormat(name); format {
+	case dotenvFormat, propertiesFormat:
+		if len(srs.Targets) > 0 {
+			return nil, fmt.Errorf("targets are not supported for %s files", format)
+		}
+
+		log.Printf("[DEBUG] Load %s as %s file", name, format)
+		return newFlatFile(d, format, metadataKey)
+	case yamlFormat:
+		f, err := newValueFileWithMetadataKey(d, metadataKey)
+		if err != nil {
+			return nil, err
+		}
+
+		f.nameField, f.valueField = srs.GetNameField(), srs.GetValueField()
+		f.targets = srs.targetNames()
 
-	if f.Metadata == nil {
-		f.Metadata = &Metadata{}
+		return f, nil
+	default:
+		return nil, fmt.Errorf("format %s is not supported, use `yaml`, `dotenv` or `properties`", format)
 	}
+}
 
+func NewValueFile(d []byte) (*File, error) {
+	return newValueFileWithMetadataKey(d, sealitYamlKey)
+}
+
+// newValueFileWithMetadataKey loads a values file, whose metadata is stored below the given key
+func newValueFileWithMetadataKey(d []byte, metadataKey string) (*File, error) {
+	log.Print("[DEBUG] Unmarshal file and prepare yaml nodes")
+	f := File{metadataKey: metadataKey, nameField: defaultNameField, valueField: defaultValueField}
 	var n yaml.Node
 
 	if err := yaml.Unmarshal(d, &n); err != nil {
@@ -41,43 +126,81 @@ func NewValueFile(d []byte) (*File, error) {
 	}
 
 	f.values = &n
+	f.Metadata = &Metadata{}
 
 	if len(f.values.Content) > 1 {
 		return nil, errors.New("sealing yaml files with more then one document is not supported")
 	}
 
+	if len(f.values.Content) == 0 {
+		f.undocumented = d
+		return &f, nil
+	}
+
+	if metadata := getValue(f.values.Content[0], f.metadataKey); metadata != nil && metadata.Kind == yaml.MappingNode {
+		if err := upgradeMetadataNode(metadata); err != nil {
+			return nil, err
+		}
+
+		if err := metadata.Decode(f.Metadata); err != nil {
+			return nil, err
+		}
+	}
+
 	return &f, nil
 }
 
-func (f *File) ApplyFuncToValues(manipulator func(*yaml.Node, *yaml.Node) error) error {
+func (f *File) getMetadata() *Metadata {
+	return f.Metadata
+}
+
+func (f *File) ApplyFuncToValues(manipulator func(string, *yaml.Node, *yaml.Node) error) error {
 	log.Printf("[DEBUG] Apply manipulation function to values tree")
-	return walkAndApplyFunc(f.values.Content[0], manipulator)
+	if len(f.values.Content) == 0 {
+		return nil
+	}
+
+	return f.walkAndApplyFunc(f.values.Content[0], "", manipulator)
 }
 
-func walkAndApplyFunc(node *yaml.Node, manipulator func(*yaml.Node, *yaml.Node) error) (err error) {
+func (f *File) walkAndApplyFunc(node *yaml.Node, path string, manipulator func(string, *yaml.Node, *yaml.Node) error) (err error) {
+	name := f.siblingName(node)
+
 	for i := 0; i < len(node.Content); i = i + 2 {
 		key := node.Content[i]
 		value := node.Content[i+1]
+		keyPath := joinPath(path, key.Value)
 		// Only walk through non sealit elements
-		if key.Value != sealitYamlKey {
+		if key.Value != f.metadataKey {
+			// The value field is matched by the name of its sibling, like `name: DB_PASSWORD` of an `env` entry
+			matchKey := key
+			if name != nil && key.Value == f.valueField {
+				matchKey = name
+			}
+
 			if value.Kind == yaml.ScalarNode {
-				if err := manipulator(key, value); err != nil {
+				if err := manipulator(keyPath, matchKey, value); err != nil {
+					return fmt.Errorf("at path %s %s", keyPath, err.Error())
+				}
+			} else if f.isTargetMap(value) {
+				if err := f.applyToTargetMap(value, keyPath, matchKey, manipulator); err != nil {
 					return err
 				}
 			} else if value.Kind == yaml.SequenceNode {
-				for _, childNode := range value.Content {
+				for j, childNode := range value.Content {
+					childPath := fmt.Sprintf("%s[%d]", keyPath, j)
 					if childNode.Kind == yaml.ScalarNode {
-						if err := manipulator(key, childNode); err != nil {
-							return err
+						if err := manipulator(childPath, key, childNode); err != nil {
+							return fmt.Errorf("at path %s %s", childPath, err.Error())
 						}
 					} else {
-						if err := walkAndApplyFunc(childNode, manipulator); err != nil {
+						if err := f.walkAndApplyFunc(childNode, childPath, manipulator); err != nil {
 							return err
 						}
 					}
 				}
 			} else {
-				if err := walkAndApplyFunc(value, manipulator); err != nil {
+				if err := f.walkAndApplyFunc(value, keyPath, manipulator); err != nil {
 					return err
 				}
 			}
@@ -86,7 +209,103 @@ func walkAndApplyFunc(node *yaml.Node, manipulator func(*yaml.Node, *yaml.Node)
 	return nil
 }
 
+// siblingName returns the value of the name field, if the mapping has a name and a value field
+func (f *File) siblingName(node *yaml.Node) *yaml.Node {
+	if node.Kind != yaml.MappingNode || f.nameField == "" {
+		return nil
+	}
+
+	name := getValue(node, f.nameField)
+	value := getValue(node, f.valueField)
+
+	if name == nil || value == nil || name.Kind != yaml.ScalarNode || (value.Kind != yaml.ScalarNode && !f.isTargetMap(value)) {
+		return nil
+	}
+
+	return name
+}
+
+// isTargetMap checks if the node maps target names to the sealed values of the targets
+func (f *File) isTargetMap(node *yaml.Node) bool {
+	if len(f.targets) == 0 || node.Kind != yaml.MappingNode || len(node.Content) == 0 {
+		return false
+	}
+
+	for i := 0; i < len(node.Content); i = i + 2 {
+		if !containsString(f.targets, node.Content[i].Value) || node.Content[i+1].Kind != yaml.ScalarNode {
+			return false
+		}
+	}
+
+	return true
+}
+
+// applyToTargetMap passes the entries of the target map with the key of the map to the manipulator
+func (f *File) applyToTargetMap(node *yaml.Node, path string, key *yaml.Node, manipulator func(string, *yaml.Node, *yaml.Node) error) error {
+	if f.wholeTargets {
+		if err := manipulator(path, key, node); err != nil {
+			return fmt.Errorf("at path %s %s", path, err.Error())
+		}
+
+		return nil
+	}
+
+	for i := 0; i < len(node.Content); i = i + 2 {
+		if f.target == "" || f.target == node.Content[i].Value {
+			entryPath := joinPath(path, node.Content[i].Value)
+			if err := manipulator(entryPath, key, node.Content[i+1]); err != nil {
+				return fmt.Errorf("at path %s %s", entryPath, err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyFuncToTarget applies the manipulator to all values, of target maps only the entry of the target is passed
+func (f *File) applyFuncToTarget(target string, manipulator func(string, *yaml.Node, *yaml.Node) error) error {
+	f.target = target
+	defer func() { f.target = "" }()
+
+	return f.ApplyFuncToValues(manipulator)
+}
+
+// applyFuncToTargetMaps applies the manipulator to all values, target maps are passed as a whole
+func (f *File) applyFuncToTargetMaps(manipulator func(string, *yaml.Node, *yaml.Node) error) error {
+	f.wholeTargets = true
+	defer func() { f.wholeTargets = false }()
+
+	return f.ApplyFuncToValues(manipulator)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// joinPath builds the dot separated YAML path of a key
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return fmt.Sprintf("%s.%s", path, key)
+}
+
 func (f *File) Export() ([]byte, error) {
+	if len(f.values.Content) == 0 {
+		log.Printf("[DEBUG] Export file without values unchanged")
+		return f.undocumented, nil
+	}
+
+	f.pruneSecretsMetadata()
+	f.Metadata.Version = currentMetadataVersion
+
 	if err := f.updateMetadata(); err != nil {
 		return nil, err
 	}
@@ -94,44 +313,182 @@ func (f *File) Export() ([]byte, error) {
 	return yaml.Marshal(f.values)
 }
 
+// pruneSecretsMetadata removes the metadata of paths which are no longer part of the values
+func (f *File) pruneSecretsMetadata() {
+	if len(f.Metadata.Secrets) == 0 && len(f.Metadata.Targets) == 0 {
+		return
+	}
+
+	paths := map[string]bool{}
+	f.walkAndApplyFunc(f.values.Content[0], "", func(path string, key *yaml.Node, value *yaml.Node) error {
+		paths[path] = true
+		return nil
+	})
+
+	pruneSecrets(f.Metadata.Secrets, paths)
+
+	for _, t := range f.Metadata.Targets {
+		pruneSecrets(t.Secrets, paths)
+	}
+}
+
+func pruneSecrets(secrets map[string]*SecretMetadata, paths map[string]bool) {
+	for path := range secrets {
+		if !paths[path] {
+			log.Printf("[DEBUG] Remove metadata of `%s` as the path does not exist anymore", path)
+			delete(secrets, path)
+		}
+	}
+}
+
 // Update MetaData
 func (f *File) updateMetadata() (err error) {
 	log.Printf("[DEBUG] Write back metadata into yaml tree")
+	node, err := metadataToYamlNode(f.Metadata)
+	if err != nil {
+		return err
+	}
+
 	// Search for sealit element an check if present
 	for i := 0; i < len(f.values.Content[0].Content); i = i + 2 {
-		if f.values.Content[0].Content[i].Value == sealitYamlKey {
-			node, err := metadataToYamlNode(f.Metadata)
-
-			if err == nil {
-				// Replace sealit node
-				f.values.Content[0].Content[i+1] = node.Content[0].Content[1]
-			}
-
-			return err
+		if f.values.Content[0].Content[i].Value == f.metadataKey {
+			// Replace sealit node
+			f.values.Content[0].Content[i+1] = node
+			return nil
 		}
 	}
 
 	// As no sealit element was found add it
-	node, err := metadataToYamlNode(f.Metadata)
+	f.values.Content[0].Content = append(f.values.Content[0].Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.metadataKey}, node)
 
-	if err == nil {
-		// Append sealit node
-		f.values.Content[0].Content = append(f.values.Content[0].Content, node.Content[0].Content...)
+	return nil
+}
+
+// MoveMetadata removes the metadata block of the file, so it is exported below the new key
+func (f *File) MoveMetadata(metadataKey string) {
+	if metadataKey == f.metadataKey {
+		return
 	}
 
-	return err
+	log.Printf("[DEBUG] Move metadata from `%s` to `%s`", f.metadataKey, metadataKey)
+	if len(f.values.Content) > 0 {
+		removeKey(f.values.Content[0], f.metadataKey)
+	}
+
+	f.metadataKey = metadataKey
 }
 
-func metadataToYamlNode(metadata *Metadata) (node yaml.Node, err error) {
-	nodeData, err := yaml.Marshal(File{
-		Metadata: metadata,
-	})
+func metadataToYamlNode(metadata *Metadata) (*yaml.Node, error) {
+	var node yaml.Node
 
-	if err == nil {
-		err = yaml.Unmarshal(nodeData, &node)
+	nodeData, err := yaml.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(nodeData, &node); err != nil {
+		return nil, err
+	}
+
+	return node.Content[0], nil
+}
+
+func (m *Metadata) isEmpty() bool {
+	return m.Name == "" && m.Namespace == "" && m.SealedAt == "" && m.Cert == "" && len(m.Secrets) == 0 && len(m.Targets) == 0
+}
+
+// targetMetadata returns the metadata of the target like the one of a file sealed for a single cluster
+func (m *Metadata) targetMetadata(target string) *Metadata {
+	t, ok := m.Targets[target]
+	if !ok {
+		return &Metadata{}
+	}
+
+	return &Metadata{
+		Version:   m.Version,
+		Name:      m.Name,
+		Namespace: m.Namespace,
+		SealedAt:  t.SealedAt,
+		Cert:      t.Cert,
+		Secrets:   t.Secrets,
+	}
+}
+
+// setTargetMetadata stores the metadata returned by targetMetadata after sealing the values of the target
+func (m *Metadata) setTargetMetadata(target string, tm *Metadata) {
+	if m.Targets == nil {
+		m.Targets = map[string]*TargetMetadata{}
+	}
+
+	m.Name = tm.Name
+	m.Namespace = tm.Namespace
+
+	if tm.SealedAt > m.SealedAt {
+		m.SealedAt = tm.SealedAt
+	}
+
+	m.Targets[target] = &TargetMetadata{
+		SealedAt: tm.SealedAt,
+		Cert:     tm.Cert,
+		Secrets:  tm.Secrets,
+	}
+}
+
+// updateSecret records when and with which cert and scope the value of the path was sealed
+func (m *Metadata) updateSecret(path string, fingerprint string, scope ssv1alpha1.SealingScope) {
+	if m.Secrets == nil {
+		m.Secrets = map[string]*SecretMetadata{}
+	}
+
+	// Keep the referenced file and the original scalar, as the sealed value does not carry them
+	secret, ok := m.Secrets[path]
+	if !ok {
+		secret = &SecretMetadata{}
+		m.Secrets[path] = secret
+	}
+
+	m.SealedAt = time.Now().Format(time.RFC3339)
+	secret.SealedAt = m.SealedAt
+	secret.Cert = fingerprint
+	secret.Scope = scope.String()
+}
+
+// recordScalar records the tag and style of the original value, strings in plain style are not recorded
+func (s *SecretMetadata) recordScalar(value *yaml.Node) {
+	s.Tag = ""
+	if tag := value.ShortTag(); tag != "!!str" {
+		s.Tag = tag
+	}
+
+	s.Style = scalarStyles[value.Style&^yaml.TaggedStyle]
+}
+
+// restoreScalar restores the tag and style of the original value
+func (s *SecretMetadata) restoreScalar(value *yaml.Node, plaintext []byte) {
+	switch s.Tag {
+	case "":
+	case "!!binary":
+		value.Tag = s.Tag
+		value.Value = base64.StdEncoding.EncodeToString(plaintext)
+	default:
+		value.Tag = s.Tag
+	}
+
+	for style, name := range scalarStyles {
+		if name == s.Style {
+			value.Style = style
+		}
+	}
+}
+
+func (m *Metadata) getScope() ssv1alpha1.SealingScope {
+	if m.Name != "" && m.Namespace != "" {
+		return ssv1alpha1.StrictScope
+	} else if m.Name == "" && m.Namespace != "" {
+		return ssv1alpha1.NamespaceWideScope
 	}
 
-	return node, err
+	return ssv1alpha1.ClusterWideScope
 }
 
 func (m *Metadata) getLabel() []byte {
@@ -1,8 +1,11 @@
 package internal
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"gopkg.in/yaml.v3"
@@ -39,6 +42,7 @@ env2:
     alpha: test!
 env3: test
 sealit:
+    version: 1
     name: ""
     namespace: ""
     sealedAt: ""
@@ -60,6 +64,7 @@ env2:
     alpha: ENC:test!
 env3: ENC:test
 sealit:
+    version: 1
     name: ""
     namespace: ""
     sealedAt: ""
@@ -118,7 +123,7 @@ func TestImportExport(t *testing.T) {
 func TestTransformingOfValues(t *testing.T) {
 	f, _ := NewValueFile(untransformedDataImport)
 
-	f.ApplyFuncToValues(func(key *yaml.Node, value *yaml.Node) error {
+	f.ApplyFuncToValues(func(path string, key *yaml.Node, value *yaml.Node) error {
 		value.SetString(fmt.Sprintf("ENC:%s", value.Value))
 		return nil
 	})
@@ -140,6 +145,21 @@ func TestImportExportOfTransformedFile(t *testing.T) {
 	}
 }
 
+func TestPathOfManipulationError(t *testing.T) {
+	f, _ := NewValueFile(untransformedDataImport)
+
+	err := f.ApplyFuncToValues(func(path string, key *yaml.Node, value *yaml.Node) error {
+		if value.Value == "test3" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	if err == nil || err.Error() != "at path env2.filters_password[1] failed" {
+		t.Errorf("Error was incorrect, got: %v, want: %s.", err, "at path env2.filters_password[1] failed")
+	}
+}
+
 func TestLoadSealitData(t *testing.T) {
 	f, _ := NewValueFile(transformedDataWithSealit)
 
@@ -194,3 +214,129 @@ func TestGetLabelForUndefinedNameAndNamespace(t *testing.T) {
 		t.Errorf("Label was incorrect, got: %s, want: %s.", l, "")
 	}
 }
+
+func TestPruneSecretsMetadata(t *testing.T) {
+	f, _ := NewValueFile(untransformedDataImport)
+	f.Metadata.Secrets = map[string]*SecretMetadata{
+		"env.password":     {},
+		"env.old_password": {},
+	}
+
+	f.Export()
+
+	if _, ok := f.Metadata.Secrets["env.old_password"]; ok {
+		t.Error("Metadata of removed path was not pruned.")
+	}
+
+	if _, ok := f.Metadata.Secrets["env.password"]; !ok {
+		t.Error("Metadata of existing path was pruned.")
+	}
+}
+
+var dataWithCustomMetadataKey = []byte(`env:
+    password: ENC:secret
+sealit: not metadata
+sealing-info:
+    version: 1
+    name: mysecret
+    namespace: default
+    sealedAt: ""
+    cert: ""
+`)
+
+func TestLoadCustomMetadataKey(t *testing.T) {
+	f, _ := newValueFileWithMetadataKey(dataWithCustomMetadataKey, "sealing-info")
+
+	if f.Metadata.Name != "mysecret" {
+		t.Errorf("Name was incorrect, got: %s, want: %s.", f.Metadata.Name, "mysecret")
+	}
+
+	d, _ := f.Export()
+
+	if !reflect.DeepEqual(d, dataWithCustomMetadataKey) {
+		t.Errorf("Exported yaml was incorrect, got: \n%s\n, want: \n%s\n.", d, dataWithCustomMetadataKey)
+	}
+}
+
+func TestMoveMetadata(t *testing.T) {
+	f, _ := NewValueFile(transformedDataWithSealit)
+
+	f.MoveMetadata("sealing-info")
+	d, _ := f.Export()
+	moved, _ := newValueFileWithMetadataKey(d, "sealing-info")
+
+	if strings.Contains(string(d), "sealit:") || moved.Metadata.Name != "mysecret" {
+		t.Errorf("Metadata was not moved, got: \n%s\n", d)
+	}
+}
+
+func TestMatchValueBySiblingName(t *testing.T) {
+	d := []byte(`env:
+    - name: DB_PASSWORD
+      value: hunter2
+    - name: DB_USER
+      value: john
+sidecar:
+    env:
+        - key: API_PASSWORD
+          secret: token
+`)
+	srs := &SealingRuleSet{}
+	vf, _ := loadValuesFile(srs, "values.yaml", d, srs.GetMetadataKey())
+	keys := map[string]string{}
+
+	vf.ApplyFuncToValues(func(path string, key *yaml.Node, value *yaml.Node) error {
+		keys[path] = key.Value
+		return nil
+	})
+
+	want := map[string]string{
+		"env[0].name":           "name",
+		"env[0].value":          "DB_PASSWORD",
+		"env[1].name":           "name",
+		"env[1].value":          "DB_USER",
+		"sidecar.env[0].key":    "key",
+		"sidecar.env[0].secret": "secret",
+	}
+
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("Keys were incorrect, got: %v, want: %v.", keys, want)
+	}
+
+	srs = &SealingRuleSet{NameField: "key", ValueField: "secret"}
+	vf, _ = loadValuesFile(srs, "values.yaml", d, srs.GetMetadataKey())
+
+	vf.ApplyFuncToValues(func(path string, key *yaml.Node, value *yaml.Node) error {
+		keys[path] = key.Value
+		return nil
+	})
+
+	if keys["sidecar.env[0].secret"] != "API_PASSWORD" || keys["env[0].value"] != "value" {
+		t.Errorf("Keys of configured fields were incorrect, got: %v.", keys)
+	}
+}
+
+func TestEmptyValuesFile(t *testing.T) {
+	for _, d := range [][]byte{[]byte(""), []byte("# no values yet\n")} {
+		f, err := NewValueFile(d)
+		if err != nil {
+			t.Fatalf("Loading was unsuccessful, got an error %s.", err.Error())
+		}
+
+		calls := 0
+		err = f.ApplyFuncToValues(func(path string, key *yaml.Node, value *yaml.Node) error {
+			calls++
+			return nil
+		})
+
+		if err != nil || calls != 0 {
+			t.Errorf("Applying was incorrect, got %d calls and error %v.", calls, err)
+		}
+
+		f.MoveMetadata("sealing-info")
+
+		if exported, err := f.Export(); err != nil || !bytes.Equal(exported, d) {
+			t.Errorf("Exported file was incorrect, got: %q (%v), want: %q.", exported, err, d)
+		}
+	}
+}